@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// context is the number of unchanged lines shown around each change in a
+// hunk.
+const context = 3
+
+type op struct {
+	kind byte // one of ' ', '-', or '+'
+	line []byte
+}
+
+func splitLines(b []byte) [][]byte {
+	lines := make([][]byte, 0)
+
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, '\n')
+
+		if i < 0 {
+			line := make([]byte, len(b)+1)
+			copy(line, b)
+			line[len(b)] = '\n'
+
+			lines = append(lines, line)
+			break
+		}
+
+		lines = append(lines, b[:i+1])
+		b = b[i+1:]
+	}
+	return lines
+}
+
+// edits returns the edits needed to turn a into b, computed from the longest
+// common subsequence of lines.
+func edits(a, b [][]byte) []op {
+	lcs := make([][]int, len(a)+1)
+
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if bytes.Equal(a[i], b[j]) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+				continue
+			}
+
+			lcs[i][j] = lcs[i+1][j]
+
+			if lcs[i][j+1] > lcs[i][j] {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	ops := make([]op, 0, len(a)+len(b))
+
+	i, j := 0, 0
+
+	for i < len(a) && j < len(b) {
+		switch {
+		case bytes.Equal(a[i], b[j]):
+			ops = append(ops, op{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, op{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, op{'+', b[j]})
+			j++
+		}
+	}
+
+	for ; i < len(a); i++ {
+		ops = append(ops, op{'-', a[i]})
+	}
+
+	for ; j < len(b); j++ {
+		ops = append(ops, op{'+', b[j]})
+	}
+	return ops
+}
+
+// diff returns the unified diff between a and b.
+func diff(aname, bname string, a, b []byte) []byte {
+	ops := edits(splitLines(a), splitLines(b))
+
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "--- %s\n+++ %s\n", aname, bname)
+
+	// aline and bline track the line numbers in a and b for the op at i.
+	aline, bline := 1, 1
+
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			aline++
+			bline++
+			i++
+			continue
+		}
+
+		// Find the start and end of the hunk, merging changes that are
+		// within context lines of each other.
+		start := i - context
+
+		if start < 0 {
+			start = 0
+		}
+
+		end := i
+
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+
+			next := end
+
+			for next < len(ops) && ops[next].kind == ' ' {
+				next++
+			}
+
+			if next == len(ops) || next-end > context*2 {
+				end += context
+
+				if end > len(ops) {
+					end = len(ops)
+				}
+				break
+			}
+			end = next
+		}
+
+		astart, bstart := aline-(i-start), bline-(i-start)
+		acount, bcount := 0, 0
+
+		for _, o := range ops[start:end] {
+			if o.kind != '+' {
+				acount++
+			}
+			if o.kind != '-' {
+				bcount++
+			}
+		}
+
+		fmt.Fprintf(&buf, "@@ -%d,%d +%d,%d @@\n", astart, acount, bstart, bcount)
+
+		for _, o := range ops[start:end] {
+			buf.WriteByte(o.kind)
+			buf.Write(o.line)
+		}
+
+		for _, o := range ops[i:end] {
+			if o.kind != '+' {
+				aline++
+			}
+			if o.kind != '-' {
+				bline++
+			}
+		}
+		i = end
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_Diff(t *testing.T) {
+	lines := func(ss ...string) string {
+		return strings.Join(ss, "\n") + "\n"
+	}
+
+	tests := []struct {
+		a, b     string
+		expected string
+	}{
+		{
+			lines("a 1", "b 2"),
+			lines("a 1", "b 2"),
+			lines("--- orig/a.conf", "+++ a.conf"),
+		},
+		{
+			lines("a 1", "b 2", "c 3"),
+			lines("a 1", "b  2", "c 3"),
+			lines(
+				"--- orig/a.conf",
+				"+++ a.conf",
+				"@@ -1,3 +1,3 @@",
+				" a 1",
+				"-b 2",
+				"+b  2",
+				" c 3",
+			),
+		},
+		{
+			lines("l1", "l2", "l3", "l4", "l5", "l6", "l7", "l8", "l9", "l10"),
+			lines("L1", "l2", "l3", "l4", "l5", "l6", "l7", "l8", "l9", "L10"),
+			lines(
+				"--- orig/a.conf",
+				"+++ a.conf",
+				"@@ -1,4 +1,4 @@",
+				"-l1",
+				"+L1",
+				" l2",
+				" l3",
+				" l4",
+				"@@ -7,4 +7,4 @@",
+				" l7",
+				" l8",
+				" l9",
+				"-l10",
+				"+L10",
+			),
+		},
+		{
+			lines("a 1", "b 2"),
+			lines("a 1", "c 3", "b 2"),
+			lines(
+				"--- orig/a.conf",
+				"+++ a.conf",
+				"@@ -1,2 +1,3 @@",
+				" a 1",
+				"+c 3",
+				" b 2",
+			),
+		},
+	}
+
+	for i, test := range tests {
+		if b := diff("orig/a.conf", "a.conf", []byte(test.a), []byte(test.b)); string(b) != test.expected {
+			t.Errorf("tests[%d] - unexpected diff\n\texpected =\n%s\n\tgot =\n%s\n", i, test.expected, string(b))
+		}
+	}
+}
@@ -0,0 +1,174 @@
+// Command conffmt formats configuration files in canonical form.
+//
+// Usage:
+//
+//	conffmt [flags] [path ...]
+//
+// Without an explicit path, it processes the standard input. Given a file, it
+// operates on that file, and given a directory, it operates on all .conf files
+// in that directory, recursively. By default, conffmt prints the formatted
+// sources to standard output.
+//
+// The flags are:
+//
+//	-d
+//		Do not print formatted sources to standard output. If a file's
+//		formatting is different than conffmt's, print diffs to standard
+//		output.
+//	-l
+//		Do not print formatted sources to standard output. If a file's
+//		formatting is different from conffmt's, print its name to standard
+//		output.
+//	-w
+//		Do not print formatted sources to standard output. If a file's
+//		formatting is different from conffmt's, overwrite it with conffmt's
+//		version.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/andrewpillar/config"
+)
+
+var (
+	list  = flag.Bool("l", false, "list files whose formatting differs from conffmt's")
+	write = flag.Bool("w", false, "write result to (source) file instead of stdout")
+	diffs = flag.Bool("d", false, "display diffs instead of rewriting files")
+
+	exitCode = 0
+)
+
+func report(err error) {
+	if errs, ok := err.(config.ErrorList); ok {
+		for _, e := range errs {
+			fmt.Fprintln(os.Stderr, e)
+		}
+	} else {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	exitCode = 2
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: conffmt [flags] [path ...]\n")
+	flag.PrintDefaults()
+}
+
+func processFile(name string, in io.Reader, out io.Writer, stdin bool) error {
+	src, err := io.ReadAll(in)
+
+	if err != nil {
+		return err
+	}
+
+	res, err := config.Format(name, src)
+
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(src, res) {
+		if *list {
+			fmt.Fprintln(out, name)
+		}
+
+		if *write {
+			if stdin {
+				return fmt.Errorf("cannot use -w with standard input")
+			}
+
+			info, err := os.Stat(name)
+
+			if err != nil {
+				return err
+			}
+
+			if err := os.WriteFile(name, res, info.Mode().Perm()); err != nil {
+				return err
+			}
+		}
+
+		if *diffs {
+			out.Write(diff("orig/"+name, name, src, res))
+		}
+	}
+
+	if !*list && !*write && !*diffs {
+		_, err = out.Write(res)
+	}
+	return err
+}
+
+func visitFile(path string, d fs.DirEntry, err error) error {
+	if err != nil {
+		report(err)
+		return nil
+	}
+
+	if d.IsDir() || !strings.HasSuffix(d.Name(), ".conf") || strings.HasPrefix(d.Name(), ".") {
+		return nil
+	}
+
+	f, err := os.Open(path)
+
+	if err != nil {
+		report(err)
+		return nil
+	}
+
+	defer f.Close()
+
+	if err := processFile(path, f, os.Stdout, false); err != nil {
+		report(err)
+	}
+	return nil
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		if err := processFile("<standard input>", os.Stdin, os.Stdout, true); err != nil {
+			report(err)
+		}
+		os.Exit(exitCode)
+	}
+
+	for _, arg := range flag.Args() {
+		info, err := os.Stat(arg)
+
+		if err != nil {
+			report(err)
+			continue
+		}
+
+		if info.IsDir() {
+			filepath.WalkDir(arg, visitFile)
+			continue
+		}
+
+		f, err := os.Open(arg)
+
+		if err != nil {
+			report(err)
+			continue
+		}
+
+		err = processFile(arg, f, os.Stdout, false)
+		f.Close()
+
+		if err != nil {
+			report(err)
+		}
+	}
+	os.Exit(exitCode)
+}
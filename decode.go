@@ -1,51 +1,449 @@
 package config
 
 import (
+	"encoding"
 	"errors"
 	"fmt"
 	"io"
+	"math/big"
+	"math/bits"
 	"os"
 	"reflect"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 	"unicode/utf8"
 )
 
-// DecodeError reports an error that occurred during decoding.
+// DecodeError reports an error that occurred during decoding. Path is the
+// dotted path to the parameter that could not be decoded, including any labels,
+// for example auth.ldap.tls.ca. Pos is the position of the innermost node that
+// caused the error, and Err is the underlying error, if any.
 type DecodeError struct {
 	Pos   Pos
+	Path  string
 	Param string
 	Label string
 	Type  reflect.Type
 	Field string
+	Err   error
 }
 
 func (e *DecodeError) Error() string {
-	param := e.Param
+	path := e.Path
 
-	if e.Label != "" {
-		param += " " + e.Label
+	if path == "" {
+		path = e.Param
+
+		if e.Label != "" {
+			path += "." + e.Label
+		}
+	}
+
+	msg := fmt.Sprintf("config: %s - cannot decode %q into ", e.Pos, path)
+
+	// There is no path for an error from the value being decoded into.
+	if path == "" {
+		msg = fmt.Sprintf("config: %s - cannot decode into ", e.Pos)
+	}
+
+	if e.Field != "" {
+		msg += "field " + e.Field + " of type "
+	}
+	msg += e.Type.String()
+
+	if e.Err != nil {
+		// Avoid repeating the position if the error is from the node at the
+		// same position.
+		if err, ok := e.Err.(*Error); ok && err.Pos == e.Pos {
+			return msg + ": " + err.Msg
+		}
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// paramPath returns the path element for the given parameter, this is the
+// name of the parameter followed by its label, if any.
+func paramPath(p *Param) string {
+	if p.Label != nil {
+		return p.Name.Value + "." + p.Label.Value
+	}
+	return p.Name.Value
+}
+
+// joinPath joins the two path elements. Array indexes, such as [0], are not
+// separated by a dot.
+func joinPath(parent, child string) string {
+	if parent == "" {
+		return child
+	}
+
+	if child == "" || strings.HasPrefix(child, "[") {
+		return parent + child
+	}
+	return parent + "." + child
+}
+
+// decodeErr returns a DecodeError for the error that occurred when decoding
+// the given parameter into the field of the given type. If err is already a
+// DecodeError from a nested parameter then it is returned as is, so the
+// innermost error is what gets reported.
+func (d *Decoder) decodeErr(p *Param, field string, rt reflect.Type, err error) error {
+	var label string
+
+	if p.Label != nil {
+		label = p.Label.Value
+	}
+
+	if decerr, ok := err.(*DecodeError); ok {
+		// Errors from array items do not know the parameter they are in.
+		if decerr.Param == "" {
+			decerr.Param = p.Name.Value
+			decerr.Label = label
+		}
+		return decerr
+	}
+
+	decerr := &DecodeError{
+		Pos:   p.Pos(),
+		Path:  d.pathTo(paramPath(p)),
+		Param: p.Name.Value,
+		Label: label,
+		Type:  rt,
+		Field: field,
+		Err:   err,
+	}
+
+	var perr *Error
+
+	if errors.As(err, &perr) {
+		decerr.Pos = perr.Pos
+	}
+	return decerr
+}
+
+// valueErr returns a DecodeError for the error that occurred when decoding a
+// value that is not a parameter, such as an array item, or the value being
+// decoded into. The parameter is filled in by decodeErr if there is one.
+func valueErr(pos Pos, path string, rt reflect.Type, err error) error {
+	if decerr, ok := err.(*DecodeError); ok {
+		return decerr
+	}
+
+	decerr := &DecodeError{
+		Pos:  pos,
+		Path: path,
+		Type: rt,
+		Err:  err,
+	}
+
+	var perr *Error
+
+	if errors.As(err, &perr) {
+		decerr.Pos = perr.Pos
+	}
+	return decerr
+}
+
+// Value is the value of a parameter that is being decoded. The Node will
+// either be a Lit, Block, or Array.
+type Value struct {
+	Node Node
+
+	d *Decoder
+}
+
+// Pos returns the position of the value.
+func (v Value) Pos() Pos {
+	return v.Node.Pos()
+}
+
+// Err returns an error with the given message, prefixed with the position of
+// the value.
+func (v Value) Err(msg string) error {
+	return v.Node.Err(msg)
+}
+
+// Decode decodes the value into the given pointer. This is decoded using the
+// same Decoder the value came from, so string literals will be interpolated,
+// and Unmarshalers will be called, as they would be during decoding.
+func (v Value) Decode(dst interface{}) error {
+	rv := reflect.ValueOf(dst)
+
+	if kind := rv.Kind(); kind != reflect.Ptr || rv.IsNil() {
+		return errors.New("cannot decode into " + kind.String())
 	}
-	return fmt.Sprintf("config: %s - cannot decode %q into field %s of type %s", e.Pos, param, e.Field, e.Type)
+
+	pv, err := v.d.decode(rv.Elem().Type(), v.Node)
+
+	if err != nil {
+		return err
+	}
+
+	rv.Elem().Set(pv)
+	return nil
+}
+
+// Unmarshaler is the interface implemented by types that can decode a value
+// of themselves. If a type implements Unmarshaler then it is used instead of
+// the default decoding for the type. Any errors returned should be positioned
+// via the Err method on the given Value.
+type Unmarshaler interface {
+	UnmarshalConfig(v Value) error
+}
+
+// Validator is the interface implemented by types that can validate themselves
+// once decoded. The Validate method is called on each value decoded from
+// configuration that implements it, after the values within it have been
+// decoded and validated. Any error returned is positioned at the node the
+// value was decoded from, such as the block for a struct.
+type Validator interface {
+	Validate() error
 }
 
 var (
-	sizb  int64 = 1
-	sizkb int64 = sizb << 10
-	sizmb int64 = sizkb << 10
-	sizgb int64 = sizmb << 10
-	siztb int64 = sizgb << 10
-
-	siztab = map[string]int64{
-		"B":  sizb,
-		"KB": sizkb,
-		"MB": sizmb,
-		"GB": sizgb,
-		"TB": siztb,
+	unmarshalerType     = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+	mapType   = reflect.TypeOf(map[string]interface{}(nil))
+	sliceType = reflect.TypeOf([]interface{}(nil))
+
+	// littab maps each literal type to the Go type it is decoded into when
+	// decoding into an empty interface.
+	littab = map[LitType]reflect.Type{
+		StringLit:   reflect.TypeOf(""),
+		IntLit:      reflect.TypeOf(int64(0)),
+		FloatLit:    reflect.TypeOf(float64(0)),
+		BoolLit:     reflect.TypeOf(false),
+		DurationLit: durationType,
+		SizeLit:     sizeType,
+	}
+)
+
+var (
+	// siztab maps each size unit to the number of bytes in the unit. The
+	// SI units are powers of 1000, and the IEC units powers of 1024.
+	siztab = map[string]Size{
+		"B":   Byte,
+		"kB":  Kilobyte,
+		"KB":  Kilobyte,
+		"MB":  Megabyte,
+		"GB":  Gigabyte,
+		"TB":  Terabyte,
+		"PB":  Petabyte,
+		"KiB": Kibibyte,
+		"MiB": Mebibyte,
+		"GiB": Gibibyte,
+		"TiB": Tebibyte,
+		"PiB": Pebibyte,
+	}
+
+	// legacytab maps the size units that are powers of 1024 when the
+	// LegacySizes option is used.
+	legacytab = map[string]Size{
+		"KB": Kibibyte,
+		"MB": Mebibyte,
+		"GB": Gibibyte,
+		"TB": Tebibyte,
+		"PB": Pebibyte,
+	}
+
+	durtab = map[string]time.Duration{
+		"ns": time.Nanosecond,
+		"us": time.Microsecond,
+		"µs": time.Microsecond, // U+00B5 micro sign
+		"μs": time.Microsecond, // U+03BC Greek letter mu
+		"ms": time.Millisecond,
+		"s":  time.Second,
+		"m":  time.Minute,
+		"h":  time.Hour,
+		"d":  24 * time.Hour,
+		"w":  7 * 24 * time.Hour,
 	}
 )
 
+// isDecimal reports whether s is a decimal number, with an optional sign and
+// fraction.
+func isDecimal(s string) bool {
+	whole, frac, _ := strings.Cut(strings.TrimPrefix(s, "-"), ".")
+
+	if whole == "" && frac == "" {
+		return false
+	}
+
+	for _, r := range whole + frac {
+		if !isDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseSize parses the given size literal into the number of bytes it
+// represents. If legacy is true then the units in legacytab are used in place
+// of their SI counterparts. The number can have a fraction, so long as the size
+// is a whole number of bytes. An error wrapping strconv.ErrRange is returned if
+// the size does not fit in an int64.
+func parseSize(s string, legacy bool) (int64, error) {
+	i := strings.IndexFunc(s, unicode.IsLetter)
+
+	if i < 0 {
+		return 0, errors.New("invalid size " + s)
+	}
+
+	unit := s[i:]
+	siz, ok := siztab[unit]
+
+	if legacy {
+		if n, ok := legacytab[unit]; ok {
+			siz = n
+		}
+	}
+
+	if !ok {
+		return 0, errors.New("unrecognized size unit " + unit)
+	}
+
+	num := strings.ReplaceAll(s[:i], "_", "")
+
+	if !isDecimal(num) {
+		return 0, errors.New("invalid size " + s)
+	}
+
+	r, _ := new(big.Rat).SetString(num)
+	r.Mul(r, new(big.Rat).SetInt64(int64(siz)))
+
+	if !r.IsInt() {
+		return 0, errors.New("size " + s + " is not a whole number of bytes")
+	}
+
+	if n := r.Num(); n.IsInt64() {
+		return n.Int64(), nil
+	}
+	return 0, fmt.Errorf("size %s: %w", s, strconv.ErrRange)
+}
+
+// leadingFraction returns the digits of the fractional part of a number as
+// an integer, along with the power of ten it is scaled by. Digits that would
+// overflow the scale are insignificant for durations, so are dropped.
+func leadingFraction(s string) (uint64, uint64, bool) {
+	var f, scale uint64 = 0, 1
+
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return 0, 0, false
+		}
+
+		if scale > (1<<63-1)/10 {
+			continue
+		}
+
+		f = f*10 + uint64(c-'0')
+		scale *= 10
+	}
+	return f, scale, true
+}
+
+// parseDuration parses the given duration literal. This is a sequence of
+// decimal numbers, each with an optional fraction and a unit, such as 1d12h,
+// or 1.5s, with an optional leading minus sign. An error wrapping
+// strconv.ErrRange is returned if the duration does not fit in an int64.
+func parseDuration(s string) (time.Duration, error) {
+	orig := s
+	neg := false
+
+	if strings.HasPrefix(s, "-") {
+		neg = true
+		s = s[1:]
+	}
+
+	if s == "" {
+		return 0, errors.New("invalid duration " + orig)
+	}
+
+	var d uint64
+
+	for s != "" {
+		i := 0
+
+		for i < len(s) && (isDigit(rune(s[i])) || s[i] == '_' || s[i] == '.') {
+			i++
+		}
+
+		num := strings.ReplaceAll(s[:i], "_", "")
+		s = s[i:]
+
+		i = 0
+
+		for i < len(s) && !isDigit(rune(s[i])) {
+			i++
+		}
+
+		unit, ok := durtab[s[:i]]
+
+		if !ok || num == "" || num == "." {
+			return 0, errors.New("invalid duration " + orig)
+		}
+		s = s[i:]
+
+		whole, frac, _ := strings.Cut(num, ".")
+
+		if whole == "" {
+			whole = "0"
+		}
+
+		w, err := strconv.ParseUint(whole, 10, 64)
+
+		if err != nil {
+			if errors.Is(err, strconv.ErrRange) {
+				return 0, fmt.Errorf("duration %s: %w", orig, strconv.ErrRange)
+			}
+			return 0, errors.New("invalid duration " + orig)
+		}
+
+		if w > (1<<63)/uint64(unit) {
+			return 0, fmt.Errorf("duration %s: %w", orig, strconv.ErrRange)
+		}
+
+		v := w * uint64(unit)
+
+		if frac != "" {
+			f, scale, ok := leadingFraction(frac)
+
+			if !ok {
+				return 0, errors.New("invalid duration " + orig)
+			}
+
+			// Scale the fraction by the unit with 128-bit arithmetic, so it
+			// is exact, f < scale so the quotient will not overflow.
+			hi, lo := bits.Mul64(f, uint64(unit))
+			q, _ := bits.Div64(hi, lo, scale)
+
+			v += q
+		}
+
+		if v > 1<<63-d {
+			return 0, fmt.Errorf("duration %s: %w", orig, strconv.ErrRange)
+		}
+		d += v
+	}
+
+	if neg {
+		return -time.Duration(d), nil
+	}
+
+	if d > 1<<63-1 {
+		return 0, fmt.Errorf("duration %s: %w", orig, strconv.ErrRange)
+	}
+	return time.Duration(d), nil
+}
+
 func (d *Decoder) interpolate(s string) (reflect.Value, error) {
 	end := len(s) - 1
 
@@ -66,7 +464,10 @@ func (d *Decoder) interpolate(s string) (reflect.Value, error) {
 
 		i += w
 
-		if r == '\\' {
+		// A $${ is a literal ${, and is never expanded.
+		if r == '$' && !interpolate && strings.HasPrefix(s[i:], "${") {
+			val = append(val, '$', '{')
+			i += 2
 			continue
 		}
 
@@ -114,12 +515,14 @@ func (d *Decoder) interpolate(s string) (reflect.Value, error) {
 	return reflect.ValueOf(string(val)), nil
 }
 
-func (d *Decoder) decodeLiteral(rt reflect.Type, lit *lit) (reflect.Value, error) {
+func (d *Decoder) decodeLiteral(rt reflect.Type, lit *Lit) (reflect.Value, error) {
 	var rv reflect.Value
 
 	switch lit.Type {
 	case StringLit:
-		if kind := rt.Kind(); kind != reflect.String {
+		textUnmarshaler := reflect.PtrTo(rt).Implements(textUnmarshalerType)
+
+		if kind := rt.Kind(); kind != reflect.String && !textUnmarshaler {
 			return rv, lit.Err("cannot use string as " + kind.String())
 		}
 		v, err := d.interpolate(lit.Value)
@@ -127,30 +530,45 @@ func (d *Decoder) decodeLiteral(rt reflect.Type, lit *lit) (reflect.Value, error
 		if err != nil {
 			return rv, lit.Err(err.Error())
 		}
+
+		if textUnmarshaler {
+			pv := reflect.New(rt)
+
+			if err := pv.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(v.String())); err != nil {
+				return rv, lit.Err(err.Error())
+			}
+			return pv.Elem(), nil
+		}
 		rv = v
 	case IntLit:
-		var bitSize int
-
 		kind := rt.Kind()
 
-		switch kind {
-		case reflect.Int:
-			bitSize = 32
-		case reflect.Int8:
-			bitSize = 8
-		case reflect.Int16:
-			bitSize = 16
-		case reflect.Int32:
-			bitSize = 32
-		case reflect.Int64:
-			bitSize = 64
+		switch {
+		case isInt(kind):
+			i, err := strconv.ParseInt(numberBase(lit.Value), 0, rt.Bits())
+
+			if err != nil {
+				return rv, lit.Err(numError(lit.Value, rt, err))
+			}
+
+			rv = reflect.New(rt).Elem()
+			rv.SetInt(i)
+		case isUint(kind):
+			if strings.HasPrefix(lit.Value, "-") {
+				return rv, lit.Err(lit.Value + " overflows " + rt.String())
+			}
+
+			u, err := strconv.ParseUint(numberBase(lit.Value), 0, rt.Bits())
+
+			if err != nil {
+				return rv, lit.Err(numError(lit.Value, rt, err))
+			}
+
+			rv = reflect.New(rt).Elem()
+			rv.SetUint(u)
 		default:
 			return rv, lit.Err("cannot use int as " + kind.String())
 		}
-
-		i, _ := strconv.ParseInt(lit.Value, 10, bitSize)
-
-		rv = reflect.ValueOf(i)
 	case FloatLit:
 		var bitSize int
 
@@ -165,8 +583,11 @@ func (d *Decoder) decodeLiteral(rt reflect.Type, lit *lit) (reflect.Value, error
 			return rv, lit.Err("cannot use float as " + kind.String())
 		}
 
-		fl, _ := strconv.ParseFloat(lit.Value, bitSize)
+		fl, err := strconv.ParseFloat(strings.ReplaceAll(lit.Value, "_", ""), bitSize)
 
+		if err != nil {
+			return rv, lit.Err(numError(lit.Value, rt, err))
+		}
 		rv = reflect.ValueOf(fl)
 	case BoolLit:
 		if kind := rt.Kind(); kind != reflect.Bool {
@@ -180,48 +601,227 @@ func (d *Decoder) decodeLiteral(rt reflect.Type, lit *lit) (reflect.Value, error
 
 		rv = reflect.ValueOf(booltab[lit.Value])
 	case DurationLit:
-		if kind := rt.Kind(); kind != reflect.Int64 {
+		if kind := rt.Kind(); !isInt(kind) && !isUint(kind) {
 			return rv, lit.Err("cannot use duration as " + kind.String())
 		}
 
-		dur, err := time.ParseDuration(lit.Value)
+		if rt == sizeType {
+			return rv, lit.Err("cannot use duration as " + rt.String())
+		}
+
+		dur, err := parseDuration(lit.Value)
 
 		if err != nil {
-			return rv, lit.Err(err.Error())
+			return rv, lit.Err(numError(lit.Value, rt, err))
 		}
-		rv = reflect.ValueOf(dur)
+		return intValue(rt, lit, int64(dur))
 	case SizeLit:
-		if kind := rt.Kind(); kind != reflect.Int64 {
+		if kind := rt.Kind(); !isInt(kind) && !isUint(kind) {
 			return rv, lit.Err("cannot use size as " + kind.String())
 		}
 
-		end := len(lit.Value) - 1
-		val := lit.Value[:end]
+		if rt == durationType || rt == configDurationType {
+			return rv, lit.Err("cannot use size as " + rt.String())
+		}
+
+		siz, err := parseSize(lit.Value, d.legacySizes)
+
+		if err != nil {
+			if errors.Is(err, strconv.ErrRange) {
+				return rv, lit.Err(numError(lit.Value, rt, err))
+			}
+			return rv, lit.Err(err.Error())
+		}
+		return intValue(rt, lit, siz)
+	}
+	return rv, nil
+}
+
+func isInt(kind reflect.Kind) bool {
+	return kind >= reflect.Int && kind <= reflect.Int64
+}
+
+func isUint(kind reflect.Kind) bool {
+	return kind >= reflect.Uint && kind <= reflect.Uintptr
+}
+
+func isNumber(kind reflect.Kind) bool {
+	return isInt(kind) || isUint(kind) || kind == reflect.Float32 || kind == reflect.Float64
+}
+
+// numberBase returns the integer s in a form that can be parsed by strconv with
+// a base of 0. Integers with a base prefix are returned as is, since strconv
+// handles the prefix and any _ separators. Decimal integers have their _
+// separators removed, and any leading zeros are stripped so they are not
+// mistaken for octal.
+func numberBase(s string) string {
+	neg := strings.HasPrefix(s, "-")
+	t := strings.TrimPrefix(s, "-")
+
+	if len(t) > 1 && t[0] == '0' && (t[1] == 'x' || t[1] == 'o' || t[1] == 'b') {
+		return s
+	}
+
+	t = strings.TrimLeft(strings.ReplaceAll(t, "_", ""), "0")
+
+	if t == "" {
+		t = "0"
+	}
+
+	if neg {
+		t = "-" + t
+	}
+	return t
+}
 
-		unitBytes := make([]byte, 1)
-		unitBytes[0] = lit.Value[end]
+// numError returns the message for the given error that occurred when parsing
+// the number s into the given type.
+func numError(s string, rt reflect.Type, err error) string {
+	if errors.Is(err, strconv.ErrRange) {
+		return s + " overflows " + rt.String()
+	}
+	return "invalid number " + s
+}
 
-		if b := lit.Value[end-1]; b == 'K' || b == 'M' || b == 'G' || b == 'T' {
-			val = lit.Value[:len(val)-1]
+// intValue returns the integer i as a value of the given integer type. An
+// error is returned if i does not fit in the type.
+func intValue(rt reflect.Type, lit *Lit, i int64) (reflect.Value, error) {
+	rv := reflect.New(rt).Elem()
 
-			unitBytes = append([]byte{b}, unitBytes[0])
+	if isUint(rt.Kind()) {
+		if i < 0 || rv.OverflowUint(uint64(i)) {
+			return rv, lit.Err(lit.Value + " overflows " + rt.String())
 		}
+		rv.SetUint(uint64(i))
+		return rv, nil
+	}
 
-		unit := string(unitBytes)
-		siz, ok := siztab[unit]
+	if rv.OverflowInt(i) {
+		return rv, lit.Err(lit.Value + " overflows " + rt.String())
+	}
+	rv.SetInt(i)
+	return rv, nil
+}
 
-		if !ok {
-			return rv, lit.Err("unrecognized size " + unit)
+// alloc follows the given value through any pointers, allocating those that
+// are nil, and returns the value that is pointed to.
+func alloc(rv reflect.Value) reflect.Value {
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
 		}
+		rv = rv.Elem()
+	}
+	return rv
+}
 
-		i, _ := strconv.ParseInt(val, 10, 64)
+// decode decodes the given node into a value of the given type. If the type
+// implements Unmarshaler, then that is used to decode the node. Pointer types
+// are allocated, and the node is decoded into the value they point to.
+func (d *Decoder) decode(rt reflect.Type, n Node) (reflect.Value, error) {
+	if reflect.PtrTo(rt).Implements(unmarshalerType) {
+		rv := reflect.New(rt)
 
-		rv = reflect.ValueOf(i * siz)
+		if err := rv.Interface().(Unmarshaler).UnmarshalConfig(Value{Node: n, d: d}); err != nil {
+			return rv, err
+		}
+		return rv.Elem(), validate(rv, n.Pos())
 	}
-	return rv, nil
+
+	if rt.Kind() == reflect.Interface {
+		if rt.NumMethod() > 0 {
+			return reflect.Value{}, n.Err("cannot decode into non-empty interface " + rt.String())
+		}
+
+		var t reflect.Type
+
+		switch v := n.(type) {
+		case *Lit:
+			t = littab[v.Type]
+		case *Block:
+			t = mapType
+		case *Array:
+			t = sliceType
+		}
+
+		pv, err := d.decode(t, n)
+
+		if err != nil {
+			return pv, err
+		}
+
+		rv := reflect.New(rt).Elem()
+		rv.Set(pv)
+
+		return rv, nil
+	}
+
+	if rt.Kind() == reflect.Ptr {
+		pv, err := d.decode(rt.Elem(), n)
+
+		if err != nil {
+			return pv, err
+		}
+
+		rv := reflect.New(rt.Elem())
+		rv.Elem().Set(pv)
+
+		return rv, nil
+	}
+
+	var (
+		rv  reflect.Value
+		err error
+	)
+
+	switch v := n.(type) {
+	case *Lit:
+		rv, err = d.decodeLiteral(rt, v)
+
+		if err == nil {
+			rv = rv.Convert(rt)
+		}
+	case *Block:
+		rv, err = d.decodeBlock(rt, v)
+	case *Array:
+		rv, err = d.decodeArray(rt, v)
+	default:
+		return reflect.Value{}, n.Err(fmt.Sprintf("cannot decode %T", n))
+	}
+
+	if err != nil {
+		return rv, err
+	}
+
+	pv := reflect.New(rt)
+	pv.Elem().Set(rv)
+
+	// Return the value from the pointer, so any changes made by a Validate
+	// method with a pointer receiver are kept.
+	err = validate(pv, n.Pos())
+	return pv.Elem(), err
 }
 
-func (d *Decoder) decodeBlock(rt reflect.Type, b *block) (reflect.Value, error) {
+// validate calls the Validate method on the given pointer if it implements
+// Validator. Any error returned is positioned at pos.
+func validate(pv reflect.Value, pos Pos) error {
+	v, ok := pv.Interface().(Validator)
+
+	if !ok {
+		return nil
+	}
+
+	if err := v.Validate(); err != nil {
+		return &Error{
+			Pos: pos,
+			Msg: err.Error(),
+			Err: err,
+		}
+	}
+	return nil
+}
+
+func (d *Decoder) decodeBlock(rt reflect.Type, b *Block) (reflect.Value, error) {
 	var rv reflect.Value
 
 	kind := rt.Kind()
@@ -239,45 +839,82 @@ func (d *Decoder) decodeBlock(rt reflect.Type, b *block) (reflect.Value, error)
 
 		el := rt.Elem()
 
-		var (
-			pv  reflect.Value
-			err error
-		)
+		for _, p := range d.dedupe(b.Params, paramPath) {
+			if p.Value == nil {
+				return rv, p.Err("no value for " + p.Name.Value)
+			}
 
-		for _, p := range b.Params {
-			switch v := p.Value.(type) {
-			case *lit:
-				pv, err = d.decodeLiteral(el, v)
+			key := reflect.ValueOf(p.Name.Value).Convert(rt.Key())
+
+			if p.Label != nil {
+				d.push(paramPath(p))
+				err := d.decodeLabel(rv, key, p)
+				d.pop()
 
 				if err != nil {
-					return rv, err
+					return rv, d.decodeErr(p, "", el, err)
 				}
-				pv = pv.Convert(el)
-			case *block:
-				pv, err = d.decodeBlock(el, v)
-			case *array:
-				pv, err = d.decodeArray(el, v)
+				continue
 			}
 
+			d.push(paramPath(p))
+			pv, err := d.decode(el, p.Value)
+			d.pop()
+
 			if err != nil {
-				return rv, err
+				return rv, d.decodeErr(p, "", el, err)
 			}
-			rv.SetMapIndex(reflect.ValueOf(p.Name.Value), pv)
+			rv.SetMapIndex(key, pv)
 		}
 		return rv, nil
 	}
 
 	rv = reflect.New(rt).Elem()
 
-	for _, p := range b.Params {
-		if err := d.doDecode(rv, p); err != nil {
-			return rv, err
-		}
+	if err := d.decodeStruct(b.Pos(), rv, b.Params); err != nil {
+		return rv, err
 	}
 	return rv, nil
 }
 
-func (d *Decoder) decodeArray(rt reflect.Type, arr *array) (reflect.Value, error) {
+// decodeLabel decodes the labelled parameter into the map under the given
+// key. Labelled parameters are grouped into a map of their own, keyed by the
+// label, so the map must either be of maps, or of empty interfaces.
+func (d *Decoder) decodeLabel(rv, key reflect.Value, p *Param) error {
+	el := rv.Type().Elem()
+	group := rv.MapIndex(key)
+
+	switch el.Kind() {
+	case reflect.Interface:
+		if group.IsValid() && !group.IsNil() && group.Elem().Type() == mapType {
+			group = group.Elem()
+			break
+		}
+		group = reflect.MakeMap(mapType)
+	case reflect.Map:
+		if el.Key().Kind() != reflect.String {
+			return p.Err("cannot decode label into non-string key")
+		}
+
+		if !group.IsValid() {
+			group = reflect.MakeMap(el)
+		}
+	default:
+		return p.Err("cannot decode label into " + el.String())
+	}
+
+	pv, err := d.decode(group.Type().Elem(), p.Value)
+
+	if err != nil {
+		return err
+	}
+
+	group.SetMapIndex(reflect.ValueOf(p.Label.Value).Convert(group.Type().Key()), pv)
+	rv.SetMapIndex(key, group)
+	return nil
+}
+
+func (d *Decoder) decodeArray(rt reflect.Type, arr *Array) (reflect.Value, error) {
 	var rv reflect.Value
 
 	if kind := rt.Kind(); kind != reflect.Slice {
@@ -288,31 +925,17 @@ func (d *Decoder) decodeArray(rt reflect.Type, arr *array) (reflect.Value, error
 
 	el := rt.Elem()
 
-	for _, it := range arr.Items {
-		val := reflect.New(el).Elem()
-
-		switch v := it.(type) {
-		case *lit:
-			litrv, err := d.decodeLiteral(el, v)
-
-			if err != nil {
-				return rv, err
-			}
-			val.Set(litrv.Convert(el))
-		case *block:
-			blockrv, err := d.decodeBlock(el, v)
-
-			if err != nil {
-				return rv, err
-			}
-			val.Set(blockrv)
-		case *array:
-			arrrv, err := d.decodeArray(el, v)
+	for i, it := range arr.Items {
+		d.push("[" + strconv.Itoa(i) + "]")
+		val, err := d.decode(el, it)
 
-			if err != nil {
-				return rv, err
-			}
-			val.Set(arrrv)
+		if err != nil {
+			err = valueErr(it.Pos(), d.pathTo(""), el, err)
+		}
+		d.pop()
+
+		if err != nil {
+			return rv, err
 		}
 		rv = reflect.Append(rv, val)
 	}
@@ -326,6 +949,24 @@ type field struct {
 	deprecated bool
 	altname    string // alternative field name if deprecated
 	nogroup    bool
+	strict     bool
+	nostrict   bool
+	required   bool
+	def        string // default value from the default struct tag
+	rules      string // rules from the validate struct tag
+	requires   []string
+	conflicts  []string
+	group      string // name of the oneof-group the field is in
+	tagged     bool   // name was given in the struct tag
+}
+
+// param returns the name of the parameter the field should be encoded as. If
+// no name was given in the struct tag then the lowercase field name is used.
+func (f *field) param() string {
+	if f.tagged {
+		return f.name
+	}
+	return strings.ToLower(f.name)
 }
 
 type fields struct {
@@ -342,9 +983,24 @@ func (f *fields) get(name string) (*field, bool) {
 	return nil, false
 }
 
+// find returns the field for the given parameter name. If there is no exact
+// match then the fields are searched using the fold function for case
+// comparison.
+func (f *fields) find(name string) (*field, bool) {
+	if fld, ok := f.get(name); ok {
+		return fld, true
+	}
+
+	for _, fld := range f.arr {
+		if fld.fold([]byte(fld.name), []byte(name)) {
+			return fld, true
+		}
+	}
+	return nil, false
+}
+
 // Stderrh provides an implementation for the errh function that will write
-// each error to standard error. This is the default error handler used by the
-// decoder if none if otherwise configured.
+// each error to standard error.
 var Stderrh = func(pos Pos, msg string) {
 	fmt.Fprintf(os.Stderr, "%s - %s\n", pos, msg)
 }
@@ -378,6 +1034,56 @@ func Envvars(d *Decoder) *Decoder {
 	return Expand("env", expandEnvvar)(d)
 }
 
+// LegacySizes makes the KB, MB, GB, TB, and PB size units powers of 1024, rather
+// than powers of 1000. This does not affect the kB, and IEC units, such as KiB.
+// Use this to decode configuration written for when these units were powers of
+// 1024 by default.
+func LegacySizes(d *Decoder) *Decoder {
+	d.legacySizes = true
+	return d
+}
+
+// Strict reports each parameter that does not map to a field as an error.
+// This can be overridden for a field with the strict and nostrict options in
+// the struct tag.
+func Strict(d *Decoder) *Decoder {
+	d.strict = true
+	return d
+}
+
+// DuplicatePolicy is the policy for handling parameters that are given more
+// than once in a block. This includes labelled parameters with the same label,
+// and parameters given again in an included file.
+type DuplicatePolicy int
+
+const (
+	// DuplicateLastWins uses the last value given for the parameter. This is the
+	// default policy.
+	DuplicateLastWins DuplicatePolicy = iota
+
+	// DuplicateError reports each duplicate parameter as an error, along with
+	// the position of where it was first given.
+	DuplicateError
+
+	// DuplicateWarn reports each duplicate parameter to the error handler,
+	// and uses the last value given for the parameter.
+	DuplicateWarn
+
+	// DuplicateMerge merges the blocks of duplicate parameters, such that
+	// the parameters in the later block override those in the earlier one.
+	// The last value is used for duplicate parameters that are not blocks.
+	DuplicateMerge
+)
+
+// Duplicates configures the policy for handling parameters that are given
+// more than once in a block.
+func Duplicates(policy DuplicatePolicy) Option {
+	return func(d *Decoder) *Decoder {
+		d.duplicates = policy
+		return d
+	}
+}
+
 // ErrorHandler configures the error handler used during parsing of a
 // configuration file.
 func ErrorHandler(errh func(Pos, string)) Option {
@@ -402,20 +1108,46 @@ func Expand(prefix string, fn ExpandFunc) Option {
 }
 
 type Decoder struct {
-	fields *fields
-
 	name string
 
-	includes bool
-	expands  map[string]ExpandFunc
-	errh     func(Pos, string)
+	includes    bool
+	legacySizes bool
+	strict      bool
+	expands     map[string]ExpandFunc
+	rules       map[string]RuleFunc
+	duplicates  DuplicatePolicy
+	errh        func(Pos, string)
+
+	// path is the stack of path elements to the parameter being decoded, and
+	// errs are the errors that do not stop decoding, such as unknown, or
+	// missing parameters.
+	path []string
+	errs ErrorList
+}
+
+func (d *Decoder) push(elem string) {
+	d.path = append(d.path, elem)
+}
+
+func (d *Decoder) pop() {
+	d.path = d.path[:len(d.path)-1]
+}
+
+// pathTo returns the dotted path to the given element from the parameter
+// currently being decoded.
+func (d *Decoder) pathTo(elem string) string {
+	var path string
+
+	for _, s := range d.path {
+		path = joinPath(path, s)
+	}
+	return joinPath(path, elem)
 }
 
 // NewDecoder returns a new decoder configured with the given options.
 func NewDecoder(name string, opts ...Option) *Decoder {
 	d := &Decoder{
 		name: name,
-		errh: Stderrh,
 	}
 
 	for _, opt := range opts {
@@ -447,6 +1179,14 @@ func (d *Decoder) Decode(v interface{}, r io.Reader) error {
 		return errors.New("cannot decode into " + kind.String())
 	}
 
+	// Decode with a copy of the decoder, so the state of each call is kept
+	// separate.
+	dec := *d
+	dec.path = nil
+	dec.errs = nil
+
+	d = &dec
+
 	p := parser{
 		scanner:  newScanner(newSource(d.name, r, d.errh)),
 		includes: d.includes,
@@ -461,22 +1201,53 @@ func (d *Decoder) Decode(v interface{}, r io.Reader) error {
 
 	el := rv.Elem()
 
+	params := make([]*Param, 0, len(nn))
+
 	for _, n := range nn {
-		param, ok := n.(*param)
+		param, ok := n.(*Param)
 
 		if !ok {
 			panic("could not type assert to *Param")
 		}
+		params = append(params, param)
+	}
 
-		if err := d.doDecode(el, param); err != nil {
-			return err
+	// Decoding into something other than a struct, such as a map, or an
+	// empty interface, so treat the file as a single block.
+	if el.Kind() != reflect.Struct {
+		pv, err := d.decode(el.Type(), &Block{Params: params})
+
+		if err != nil {
+			return valueErr(Pos{File: d.name}, "", el.Type(), err)
 		}
+
+		el.Set(pv)
+
+		d.errs.Sort()
+		return d.errs.Err()
+	}
+
+	pos := Pos{File: d.name}
+
+	if err := d.decodeStruct(pos, el, params); err != nil {
+		return err
+	}
+
+	if len(d.errs) > 0 {
+		d.errs.Sort()
+		return d.errs
+	}
+
+	if err := validate(rv, pos); err != nil {
+		return valueErr(pos, "", el.Type(), err)
 	}
 	return nil
 }
 
-func (d *Decoder) loadFields(rv reflect.Value) {
-	d.fields = &fields{
+// loadFields returns the fields of the given struct value that can be mapped
+// to a parameter. Unexported fields, and fields with the name "-" are skipped.
+func loadFields(rv reflect.Value) *fields {
+	fields := &fields{
 		arr: make([]*field, 0),
 		tab: make(map[string]int),
 	}
@@ -488,17 +1259,30 @@ func (d *Decoder) loadFields(rv reflect.Value) {
 			deprecated bool
 			altname    string
 
-			nogroup bool
+			nogroup  bool
+			strict   bool
+			nostrict bool
+			required bool
+			tagged   bool
+
+			requires  []string
+			conflicts []string
+			group     string
 		)
 
 		sf := t.Field(i)
 
+		if sf.PkgPath != "" {
+			continue
+		}
+
 		name := sf.Name
 
 		if tag := sf.Tag.Get("config"); tag != "" {
 			parts := strings.Split(tag, ",")
 
 			name = parts[0]
+			tagged = name != ""
 
 			if name == "" {
 				name = sf.Name
@@ -506,6 +1290,18 @@ func (d *Decoder) loadFields(rv reflect.Value) {
 
 			if len(parts) > 1 {
 				for _, part := range parts[1:] {
+					if name, val, ok := strings.Cut(part, "="); ok {
+						switch name {
+						case "requires":
+							requires = strings.Fields(val)
+						case "conflicts":
+							conflicts = strings.Fields(val)
+						case "oneof-group":
+							group = val
+						}
+						continue
+					}
+
 					if strings.HasPrefix(part, "deprecated") {
 						deprecated = true
 
@@ -515,8 +1311,15 @@ func (d *Decoder) loadFields(rv reflect.Value) {
 						continue
 					}
 
-					if part == "nogroup" {
+					switch part {
+					case "nogroup":
 						nogroup = true
+					case "strict":
+						strict = true
+					case "nostrict":
+						nostrict = true
+					case "required":
+						required = true
 					}
 				}
 			}
@@ -526,127 +1329,519 @@ func (d *Decoder) loadFields(rv reflect.Value) {
 			continue
 		}
 
-		d.fields.arr = append(d.fields.arr, &field{
+		fields.tab[name] = len(fields.arr)
+		fields.arr = append(fields.arr, &field{
 			name:       name,
 			val:        rv.Field(i),
 			fold:       foldFunc([]byte(name)),
 			deprecated: deprecated,
 			altname:    altname,
 			nogroup:    nogroup,
+			strict:     strict,
+			nostrict:   nostrict,
+			required:   required,
+			def:        sf.Tag.Get("default"),
+			rules:      sf.Tag.Get("validate"),
+			requires:   requires,
+			conflicts:  conflicts,
+			group:      group,
+			tagged:     tagged,
 		})
-		d.fields.tab[name] = i
 	}
+	return fields
 }
 
-func (d *Decoder) doDecode(rv reflect.Value, p *param) error {
-	d.loadFields(rv)
+// decodeStruct decodes the given parameters into the fields of the struct.
+// Fields that are not set by the parameters are given their default value, if
+// any. The given position is that of the block the parameters are in, errors
+// that are not for a single parameter, such as a missing required field, are
+// reported there.
+func (d *Decoder) decodeStruct(pos Pos, rv reflect.Value, params []*Param) error {
+	fields := loadFields(rv)
+	set := make(map[string]*Param)
 
-	f, ok := d.fields.get(p.Name.Value)
+	params = d.dedupe(params, func(p *Param) string {
+		f, ok := fields.find(p.Name.Value)
 
-	if !ok {
-		// Lazily search across all fields using the fold function for case
-		// comparison.
-		for _, fld := range d.fields.arr {
-			if fld.fold([]byte(fld.name), []byte(p.Name.Value)) {
-				f = fld
-				break
+		if !ok {
+			return ""
+		}
+
+		if p.Label != nil {
+			// Labels for nogroup fields are deduped when decoded as
+			// parameters of the field's struct.
+			if f.nogroup {
+				return ""
 			}
+			return f.name + "." + p.Label.Value
+		}
+		return f.name
+	})
+
+	nogroup := make(map[string][]*Param)
+
+	// labelled is the first labelled parameter of each field decoded into a
+	// map, this is where any errors for the rules of the map are reported.
+	labelled := make(map[string]*Param)
+
+	for _, p := range params {
+		f, ok := fields.find(p.Name.Value)
+
+		if !ok {
+			if d.strict {
+				d.errs.Add(p.Pos(), "unknown parameter "+d.pathTo(p.Name.Value))
+			}
+			continue
+		}
+
+		set[f.name] = p
+
+		if f.nogroup && p.Label != nil {
+			nogroup[f.name] = append(nogroup[f.name], p)
+			continue
+		}
+
+		if _, ok := labelled[f.name]; !ok && p.Label != nil {
+			labelled[f.name] = p
+		}
+
+		if err := d.doDecode(f, p); err != nil {
+			return err
 		}
 	}
 
-	if f == nil {
-		return nil
+	for _, f := range fields.arr {
+		// Nogroup fields are decoded even if none of their labels are given,
+		// so any required labels are reported.
+		if params, ok := nogroup[f.name]; ok || f.nogroup && set[f.name] == nil {
+			if err := d.decodeNogroup(pos, f, params); err != nil {
+				return err
+			}
+		}
+
+		if p, ok := labelled[f.name]; ok && f.rules != "" {
+			if err := d.checkRules(f.rules, f.val, p.Pos()); err != nil {
+				return d.fieldErr(p.Pos(), f, err)
+			}
+		}
 	}
 
-	if f.deprecated {
-		msg := p.Name.Value + " is deprecated"
+	d.checkDeps(pos, fields, set)
+
+	for _, f := range fields.arr {
+		if _, ok := set[f.name]; ok {
+			continue
+		}
+
+		if f.required {
+			d.errs.Add(pos, "missing required parameter "+d.pathTo(f.param()))
+			continue
+		}
 
-		if f.altname != "" {
-			msg += " use " + f.altname + " instead"
+		if err := d.setDefault(pos, f); err != nil {
+			return err
 		}
-		d.errh(p.Pos(), msg)
 	}
+	return nil
+}
+
+// fieldErr returns a DecodeError positioned at pos for the error that occurred
+// with the field when there is no parameter for it, such as with a default
+// value.
+func (d *Decoder) fieldErr(pos Pos, f *field, err error) error {
+	return &DecodeError{
+		Pos:   pos,
+		Path:  d.pathTo(f.param()),
+		Param: f.param(),
+		Type:  f.val.Type(),
+		Field: f.name,
+		Err:   err,
+	}
+}
 
-	el := f.val.Type()
+// dedupe handles the parameters that are given more than once in a block as
+// per the duplicate policy of the decoder. The key function returns the key
+// used to identify a parameter, parameters with an empty key are left as is.
+func (d *Decoder) dedupe(params []*Param, key func(p *Param) string) []*Param {
+	if d.duplicates == DuplicateLastWins {
+		return params
+	}
 
-	if p.Label != nil {
-		// We don't want to group the parameter under a label, so make sure
-		// we're decoding into a struct, whereby the label would map to the
-		// struct field.
-		if f.nogroup {
-			if f.val.Kind() != reflect.Struct {
-				return &DecodeError{
-					Pos:   p.Pos(),
-					Param: p.Name.Value,
-					Label: p.Label.Value,
-					Type:  el,
-					Field: f.name,
+	deduped := make([]*Param, 0, len(params))
+	seen := make(map[string]int)
+
+	for _, p := range params {
+		k := key(p)
+
+		if k == "" {
+			deduped = append(deduped, p)
+			continue
+		}
+
+		i, ok := seen[k]
+
+		if !ok {
+			seen[k] = len(deduped)
+			deduped = append(deduped, p)
+			continue
+		}
+
+		prev := deduped[i]
+		msg := "duplicate parameter " + d.pathTo(paramPath(p)) + ", previously given at " + prev.Pos().String()
+
+		switch d.duplicates {
+		case DuplicateError:
+			d.errs.Add(p.Pos(), msg)
+			continue
+		case DuplicateWarn:
+			if d.errh != nil {
+				d.errh(p.Pos(), msg)
+			}
+		case DuplicateMerge:
+			// Merge the blocks by decoding the parameters of both as if
+			// they were one block. Any duplicates within the merged block
+			// are then merged too.
+			a, ok1 := prev.Value.(*Block)
+			b, ok2 := p.Value.(*Block)
+
+			if ok1 && ok2 {
+				merged := &Block{
+					baseNode: a.baseNode,
+					Params:   make([]*Param, 0, len(a.Params)+len(b.Params)),
+					Rbrace:   a.Rbrace,
+				}
+
+				merged.Params = append(merged.Params, a.Params...)
+				merged.Params = append(merged.Params, b.Params...)
+
+				mp := *prev
+				mp.Value = merged
+
+				deduped[i] = &mp
+				continue
+			}
+		}
+		deduped = append(deduped, p)
+	}
+	return deduped
+}
+
+// checkDeps checks the requires, conflicts, and oneof-group options of the
+// fields against the parameters that were set in a block. Errors for a
+// missing oneof-group are reported at pos.
+func (d *Decoder) checkDeps(pos Pos, fields *fields, set map[string]*Param) {
+	lookup := func(name string) (*field, *Param) {
+		if f, ok := fields.find(name); ok {
+			return f, set[f.name]
+		}
+		return nil, nil
+	}
+
+	// Conflicts are only reported once, even if given on both fields.
+	reported := make(map[[2]string]struct{})
+
+	conflict := func(f *field, p *Param, g *field, q *Param) {
+		key := [2]string{f.name, g.name}
+
+		if g.name < f.name {
+			key = [2]string{g.name, f.name}
+		}
+
+		if _, ok := reported[key]; ok {
+			return
+		}
+		reported[key] = struct{}{}
+
+		// Report the conflict at whichever parameter came last.
+		if p.Pos().Offset < q.Pos().Offset {
+			f, p, g, q = g, q, f, p
+		}
+		d.errs.Add(p.Pos(), d.pathTo(f.param())+" conflicts with "+d.pathTo(g.param())+" at "+q.Pos().String())
+	}
+
+	groups := make(map[string][]*field)
+	order := make([]string, 0)
+
+	for _, f := range fields.arr {
+		if f.group != "" {
+			if _, ok := groups[f.group]; !ok {
+				order = append(order, f.group)
+			}
+			groups[f.group] = append(groups[f.group], f)
+		}
+
+		p, ok := set[f.name]
+
+		if !ok {
+			continue
+		}
+
+		for _, name := range f.requires {
+			if g, q := lookup(name); q == nil {
+				if g != nil {
+					name = g.param()
 				}
+				d.errs.Add(p.Pos(), d.pathTo(f.param())+" requires "+d.pathTo(name))
 			}
+		}
 
-			return d.doDecode(f.val, &param{
-				baseNode: p.baseNode,
-				Name:     p.Label,
-				Value:    p.Value,
-			})
+		for _, name := range f.conflicts {
+			if g, q := lookup(name); q != nil {
+				conflict(f, p, g, q)
+			}
 		}
+	}
+
+	for _, name := range order {
+		var first *field
+
+		names := make([]string, 0, len(groups[name]))
+
+		for _, f := range groups[name] {
+			names = append(names, d.pathTo(f.param()))
 
-		if f.val.Kind() != reflect.Map {
-			return &DecodeError{
-				Pos:   p.Pos(),
-				Param: p.Name.Value,
-				Label: p.Label.Value,
-				Type:  el,
-				Field: f.name,
+			if _, ok := set[f.name]; !ok {
+				continue
+			}
+
+			if first == nil {
+				first = f
+				continue
 			}
+			conflict(f, set[f.name], first, set[first.name])
 		}
 
-		t := f.val.Type()
-		el = t.Elem()
+		if first == nil {
+			d.errs.Add(pos, "one of "+strings.Join(names, ", ")+" is required")
+		}
+	}
+}
 
-		if f.val.IsNil() {
-			f.val.Set(reflect.MakeMap(t))
+// setDefault sets the field to its default value if the field is zero, and
+// checks the rules of the field against it. The default value is parsed as an
+// operand, so it is written the same as it would be in configuration, for
+// example 10s, or 50MB. If the field has no default value and is a struct, then
+// the defaults are set for the fields in the struct instead.
+func (d *Decoder) setDefault(pos Pos, f *field) error {
+	if f.def == "" {
+		if f.val.Kind() != reflect.Struct {
+			return nil
 		}
+
+		d.push(f.param())
+		defer d.pop()
+
+		for _, fld := range loadFields(f.val).arr {
+			if err := d.setDefault(pos, fld); err != nil {
+				return err
+			}
+		}
+		return nil
 	}
 
-	var (
-		pv  reflect.Value
-		err error
-	)
+	if !f.val.IsZero() {
+		return nil
+	}
 
-	switch v := p.Value.(type) {
-	case *lit:
-		pv, err = d.decodeLiteral(el, v)
+	pv, err := d.decodeDefault(f.val.Type(), f.def)
 
-		if err != nil {
-			return &DecodeError{
-				Pos:   p.Pos(),
-				Param: p.Name.Value,
-				Type:  el,
-				Field: f.name,
+	if err != nil {
+		return d.fieldErr(pos, f, err)
+	}
+
+	f.val.Set(pv)
+
+	if f.rules != "" {
+		if err := d.checkRules(f.rules, f.val, pos); err != nil {
+			return d.fieldErr(pos, f, err)
+		}
+	}
+	return nil
+}
+
+// parseTag parses the value of the given struct tag as an operand, for
+// decoding into the given type. Unquoted values for types that are decoded from
+// a string, such as string, or encoding.TextUnmarshaler, are treated as string
+// literals, so they do not need quoting in the struct tag. The exception is
+// numeric types, such as Size, where a value that is a number, size, or
+// duration literal is decoded as it would be in configuration.
+func parseTag(name string, rt reflect.Type, s string) (Node, error) {
+	if rt.Kind() == reflect.String || reflect.PtrTo(rt).Implements(textUnmarshalerType) {
+		if s == "" || s[0] != '"' && s[0] != '`' {
+			if isNumber(rt.Kind()) {
+				if n, err := parseOperand(name, s); err == nil {
+					if lit, ok := n.(*Lit); ok && lit.Type != StringLit && lit.Type != BoolLit {
+						return lit, nil
+					}
+				}
 			}
+
+			return &Lit{
+				baseNode: baseNode{pos: Pos{File: name, Line: 1, Col: 1}},
+				Type:     StringLit,
+				Value:    s,
+				Raw:      s,
+			}, nil
 		}
-		pv = pv.Convert(el)
-	case *block:
-		pv, err = d.decodeBlock(el, v)
-	case *array:
-		pv, err = d.decodeArray(el, v)
 	}
+	return parseOperand(name, s)
+}
+
+// decodeDefault decodes the value of the default struct tag into a value of
+// the given type.
+func (d *Decoder) decodeDefault(rt reflect.Type, def string) (reflect.Value, error) {
+	n, err := parseTag("default", rt, def)
 
 	if err != nil {
-		return &DecodeError{
-			Pos:   p.Pos(),
-			Param: p.Name.Value,
-			Type:  el,
-			Field: f.name,
+		return reflect.Value{}, err
+	}
+	return d.decode(rt, n)
+}
+
+// useStrict sets the strict mode for decoding into the given field, as per its
+// strict and nostrict options. The returned function restores the previous
+// mode.
+func (d *Decoder) useStrict(f *field) func() {
+	strict := d.strict
+
+	if f.strict {
+		d.strict = true
+	}
+	if f.nostrict {
+		d.strict = false
+	}
+
+	return func() {
+		d.strict = strict
+	}
+}
+
+func (d *Decoder) warnDeprecated(f *field, p *Param) {
+	if !f.deprecated || d.errh == nil {
+		return
+	}
+
+	msg := p.Name.Value + " is deprecated"
+
+	if f.altname != "" {
+		msg += " use " + f.altname + " instead"
+	}
+	d.errh(p.Pos(), msg)
+}
+
+// decodeNogroup decodes the labelled parameters for a field with the nogroup
+// option. The parameters are decoded into the struct of the field as a single
+// block, whereby each label maps to a field in the struct. This way the labels
+// are checked as any other parameter would be, such as for required, or
+// default values.
+func (d *Decoder) decodeNogroup(pos Pos, f *field, params []*Param) error {
+	defer d.useStrict(f)()
+
+	if len(params) == 0 {
+		rt := f.val.Type()
+
+		for rt.Kind() == reflect.Ptr {
+			rt = rt.Elem()
+		}
+
+		if rt.Kind() != reflect.Struct {
+			return nil
+		}
+
+		// Decode into a zero value if the field is a nil pointer, so it is
+		// not allocated when none of its labels are given.
+		val := reflect.New(rt).Elem()
+
+		if v, ok := indirect(f.val); ok {
+			val = v
+		}
+
+		d.push(f.param())
+		defer d.pop()
+
+		return d.decodeStruct(pos, val, nil)
+	}
+
+	val := alloc(f.val)
+
+	if val.Kind() != reflect.Struct {
+		return d.decodeErr(params[0], f.name, f.val.Type(), nil)
+	}
+
+	fields := loadFields(val)
+	labels := make([]*Param, 0, len(params))
+
+	for _, p := range params {
+		d.warnDeprecated(f, p)
+
+		if _, ok := fields.find(p.Label.Value); !ok {
+			if d.strict {
+				d.errs.Add(p.Label.Pos(), "unknown label "+d.pathTo(paramPath(p)))
+			}
+			continue
+		}
+
+		labels = append(labels, &Param{
+			baseNode: p.baseNode,
+			Name:     p.Label,
+			Value:    p.Value,
+		})
+	}
+
+	d.push(params[0].Name.Value)
+	defer d.pop()
+
+	return d.decodeStruct(pos, val, labels)
+}
+
+func (d *Decoder) doDecode(f *field, p *Param) error {
+	defer d.useStrict(f)()
+
+	d.warnDeprecated(f, p)
+
+	el := f.val.Type()
+
+	if p.Label != nil {
+		val := alloc(f.val)
+
+		if val.Kind() != reflect.Map {
+			return d.decodeErr(p, f.name, el, nil)
+		}
+
+		t := val.Type()
+		el = t.Elem()
+
+		if val.IsNil() {
+			val.Set(reflect.MakeMap(t))
 		}
 	}
 
+	if p.Value == nil {
+		return d.decodeErr(p, f.name, el, errors.New("no value"))
+	}
+
+	d.push(paramPath(p))
+	pv, err := d.decode(el, p.Value)
+	d.pop()
+
+	if err != nil {
+		return d.decodeErr(p, f.name, el, err)
+	}
+
+	// The rules for labelled parameters are checked against the whole map
+	// once all of the labels have been decoded.
 	if p.Label != nil {
-		f.val.SetMapIndex(reflect.ValueOf(p.Label.Value), pv)
+		val := alloc(f.val)
+		val.SetMapIndex(reflect.ValueOf(p.Label.Value).Convert(val.Type().Key()), pv)
 		return nil
 	}
 
+	if f.rules != "" {
+		if err := d.checkRules(f.rules, pv, p.Value.Pos()); err != nil {
+			return d.decodeErr(p, f.name, el, err)
+		}
+	}
+
 	f.val.Set(pv)
 	return nil
 }
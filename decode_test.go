@@ -1,13 +1,39 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/netip"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
 
+// checkerrs checks that err is an ErrorList with the expected errors.
+func checkerrs(t *testing.T, err error, expected []string) {
+	errs, ok := err.(ErrorList)
+
+	if !ok {
+		t.Fatalf("unexpected error type, expected=%T, got=%T\n", errs, err)
+	}
+
+	if l := len(errs); l != len(expected) {
+		t.Fatalf("unexpected number of errors, expected=%d, got=%d\n%v\n", len(expected), l, errs)
+	}
+
+	for i, e := range errs {
+		if e.Error() != expected[i] {
+			t.Errorf("errs[%d] - unexpected error, expected=%q, got=%q\n", i, expected[i], e.Error())
+		}
+	}
+}
+
 func Test_DecodeSimpleConfig(t *testing.T) {
 	var cfg struct {
 		Log map[string]string
@@ -258,15 +284,76 @@ func Test_DecodeUTF8(t *testing.T) {
 }
 
 func Test_DecodeDuration(t *testing.T) {
-	var cfg struct {
+	type durationCfg struct {
 		Hour            time.Duration
 		HourHalf        time.Duration `config:"hour_half"`
 		HourHalfSeconds time.Duration `config:"hour_half_seconds"`
+		Nanos           time.Duration
+		Micros          time.Duration
+		MicroSign       time.Duration `config:"micro_sign"`
+		Millis          time.Duration
+		Day             time.Duration
+		DayHalf         time.Duration `config:"day_half"`
+		Week            time.Duration
+		Fraction        time.Duration
+		FracMinutes     time.Duration `config:"frac_minutes"`
+		FracHours       time.Duration `config:"frac_hours"`
+		Negative        time.Duration
 	}
 
+	var cfg durationCfg
+
 	if err := DecodeFile(&cfg, filepath.Join("testdata", "duration.conf"), ErrorHandler(errh(t))); err != nil {
 		t.Fatal(err)
 	}
+
+	expected := durationCfg{
+		Hour:            time.Hour,
+		HourHalf:        time.Hour + 30*time.Minute,
+		HourHalfSeconds: time.Hour + 30*time.Minute + 45*time.Second,
+		Nanos:           100 * time.Nanosecond,
+		Micros:          250 * time.Microsecond,
+		MicroSign:       250 * time.Microsecond,
+		Millis:          500 * time.Millisecond,
+		Day:             24 * time.Hour,
+		DayHalf:         36 * time.Hour,
+		Week:            14 * 24 * time.Hour,
+		Fraction:        36 * time.Hour,
+		FracMinutes:     94200 * time.Millisecond,
+		FracHours:       252 * time.Millisecond,
+		Negative:        -(time.Minute + 30*time.Second),
+	}
+
+	if !reflect.DeepEqual(cfg, expected) {
+		t.Fatalf("decoded configuration does not match\n\texpected =%v\n\tgot = %v\n", expected, cfg)
+	}
+
+	err := NewDecoder("duration.conf", ErrorHandler(errh(t))).Decode(&cfg, strings.NewReader("week 20000w"))
+
+	decerr, ok := err.(*DecodeError)
+
+	if !ok {
+		t.Fatalf("unexpected error type, expected=%T, got=%T\n", decerr, err)
+	}
+
+	if expected := "duration.conf,1:6 - 20000w overflows time.Duration"; decerr.Err == nil || decerr.Err.Error() != expected {
+		t.Fatalf("unexpected error, expected=%q, got=%q\n", expected, decerr.Err)
+	}
+
+	// Fractions should be exact, and match time.ParseDuration.
+	for i := 1; i < 100000; i++ {
+		s := fmt.Sprintf("0.%05dh", i)
+
+		d, err := parseDuration(s)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected, _ := time.ParseDuration(s); d != expected {
+			t.Fatalf("%s: unexpected duration, expected=%d, got=%d\n", s, expected, d)
+		}
+	}
 }
 
 func Test_DecodeInclude(t *testing.T) {
@@ -387,3 +474,1161 @@ func Test_DecodeMap(t *testing.T) {
 		t.Fatalf("decoded configuration does not match\n\texpected =%v\n\tgot = %v\n", expected, cfg)
 	}
 }
+
+type logLevel int
+
+const (
+	debugLevel logLevel = iota
+	infoLevel
+	warnLevel
+	errorLevel
+)
+
+func (l *logLevel) UnmarshalConfig(v Value) error {
+	var s string
+
+	if err := v.Decode(&s); err != nil {
+		return err
+	}
+
+	switch s {
+	case "debug":
+		*l = debugLevel
+	case "info":
+		*l = infoLevel
+	case "warn":
+		*l = warnLevel
+	case "error":
+		*l = errorLevel
+	default:
+		return v.Err("unknown log level " + s)
+	}
+	return nil
+}
+
+func Test_DecodeUnmarshaler(t *testing.T) {
+	type logCfg struct {
+		Level  logLevel
+		Levels []logLevel
+		Log    map[string]struct {
+			Level logLevel
+		}
+	}
+
+	var cfg logCfg
+
+	if err := DecodeFile(&cfg, filepath.Join("testdata", "unmarshal.conf"), ErrorHandler(errh(t))); err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Level != warnLevel {
+		t.Fatalf("unexpected Level, expected=%d, got=%d\n", warnLevel, cfg.Level)
+	}
+
+	if !reflect.DeepEqual(cfg.Levels, []logLevel{debugLevel, infoLevel}) {
+		t.Fatalf("unexpected Levels, expected=%v, got=%v\n", []logLevel{debugLevel, infoLevel}, cfg.Levels)
+	}
+
+	if cfg.Log["file"].Level != errorLevel {
+		t.Fatalf("unexpected Log.file.Level, expected=%d, got=%d\n", errorLevel, cfg.Log["file"].Level)
+	}
+
+	dec := NewDecoder("level.conf", ErrorHandler(errh(t)))
+
+	err := dec.Decode(&cfg, strings.NewReader(`level "trace"`))
+
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	decerr, ok := err.(*DecodeError)
+
+	if !ok {
+		t.Fatalf("unexpected error type, expected=%T, got=%T\n", decerr, err)
+	}
+
+	expected := "level.conf,1:7 - unknown log level trace"
+
+	if decerr.Err == nil || decerr.Err.Error() != expected {
+		t.Fatalf("unexpected error, expected=%q, got=%q\n", expected, decerr.Err)
+	}
+}
+
+func Test_DecodeTextUnmarshaler(t *testing.T) {
+	var cfg struct {
+		Addr  netip.Addr
+		IP    net.IP
+		Level slog.Level
+		Total big.Int
+		Peers []netip.Addr
+	}
+
+	if err := DecodeFile(&cfg, filepath.Join("testdata", "text.conf"), ErrorHandler(errh(t))); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := netip.MustParseAddr("192.168.1.10"); cfg.Addr != expected {
+		t.Fatalf("unexpected Addr, expected=%s, got=%s\n", expected, cfg.Addr)
+	}
+
+	if expected := net.ParseIP("10.0.0.1"); !cfg.IP.Equal(expected) {
+		t.Fatalf("unexpected IP, expected=%s, got=%s\n", expected, cfg.IP)
+	}
+
+	if cfg.Level != slog.LevelWarn {
+		t.Fatalf("unexpected Level, expected=%s, got=%s\n", slog.LevelWarn, cfg.Level)
+	}
+
+	if expected := "123456789012345678901234567890"; cfg.Total.String() != expected {
+		t.Fatalf("unexpected Total, expected=%s, got=%s\n", expected, cfg.Total.String())
+	}
+
+	peers := []netip.Addr{
+		netip.MustParseAddr("10.0.0.2"),
+		netip.MustParseAddr("10.0.0.3"),
+	}
+
+	if !reflect.DeepEqual(cfg.Peers, peers) {
+		t.Fatalf("unexpected Peers, expected=%v, got=%v\n", peers, cfg.Peers)
+	}
+
+	dec := NewDecoder("addr.conf", ErrorHandler(errh(t)))
+
+	err := dec.Decode(&cfg, strings.NewReader(`addr "localhost"`))
+
+	decerr, ok := err.(*DecodeError)
+
+	if !ok {
+		t.Fatalf("unexpected error type, expected=%T, got=%T\n", decerr, err)
+	}
+
+	if prefix := "addr.conf,1:6 - "; decerr.Err == nil || !strings.HasPrefix(decerr.Err.Error(), prefix) {
+		t.Fatalf("unexpected error, expected prefix=%q, got=%q\n", prefix, decerr.Err)
+	}
+}
+
+func Test_DecodeInts(t *testing.T) {
+	type Port uint16
+	type Mode uint32
+
+	type intCfg struct {
+		Int    int
+		Int8   int8
+		Uint   uint
+		Uint8  uint8
+		Uint16 uint16
+		Uint64 uint64
+		Port   Port
+		Mode   Mode
+		Cache  uint64
+		Buffer int32
+		Period int64
+		Retry  uint64
+	}
+
+	var cfg intCfg
+
+	if err := DecodeFile(&cfg, filepath.Join("testdata", "int.conf"), ErrorHandler(errh(t))); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := intCfg{
+		Int:    -42,
+		Int8:   127,
+		Uint:   42,
+		Uint8:  255,
+		Uint16: 65535,
+		Uint64: 18446744073709551615,
+		Port:   8080,
+		Mode:   420,
+		Cache:  512 << 20,
+		Buffer: 4 << 10,
+		Period: int64(2 * time.Hour),
+		Retry:  uint64(90 * time.Second),
+	}
+
+	if !reflect.DeepEqual(cfg, expected) {
+		t.Fatalf("decoded configuration does not match\n\texpected =%v\n\tgot = %v\n", expected, cfg)
+	}
+
+	tests := []struct {
+		src string
+		err string
+	}{
+		{"int8 128", "int.conf,1:6 - 128 overflows int8"},
+		{"uint8 256", "int.conf,1:7 - 256 overflows uint8"},
+		{"uint -1", "int.conf,1:6 - -1 overflows uint"},
+		{"int 99999999999999999999", "int.conf,1:5 - 99999999999999999999 overflows int"},
+		{"port 65536", "int.conf,1:6 - 65536 overflows config.Port"},
+		{"buffer 4GB", "int.conf,1:8 - 4GB overflows int32"},
+		{"cache 99999999999TB", "int.conf,1:7 - 99999999999TB overflows uint64"},
+		{"mode 1h", "int.conf,1:6 - 1h overflows config.Mode"},
+	}
+
+	for _, test := range tests {
+		err := NewDecoder("int.conf", ErrorHandler(errh(t))).Decode(&cfg, strings.NewReader(test.src))
+
+		decerr, ok := err.(*DecodeError)
+
+		if !ok {
+			t.Fatalf("%q: unexpected error type, expected=%T, got=%T\n", test.src, decerr, err)
+		}
+
+		if decerr.Err == nil || decerr.Err.Error() != test.err {
+			t.Fatalf("%q: unexpected error, expected=%q, got=%q\n", test.src, test.err, decerr.Err)
+		}
+	}
+}
+
+func Test_DecodePointers(t *testing.T) {
+	type Redis struct {
+		Addr string
+	}
+
+	var cfg struct {
+		Workers *int64
+		Debug   *bool
+		Timeout *time.Duration
+
+		Cache struct {
+			Redis    *Redis
+			Memcache *struct {
+				Addr string
+			}
+		}
+
+		Tags []*string
+
+		Store *map[string]*struct {
+			Path *string
+		}
+
+		Driver *struct {
+			Docker *struct {
+				Host string
+			}
+		} `config:",nogroup"`
+	}
+
+	if err := DecodeFile(&cfg, filepath.Join("testdata", "pointer.conf"), ErrorHandler(errh(t))); err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Workers == nil || *cfg.Workers != 0 {
+		t.Fatalf("unexpected Workers, expected=%d, got=%v\n", 0, cfg.Workers)
+	}
+
+	if cfg.Debug == nil || *cfg.Debug {
+		t.Fatalf("unexpected Debug, expected=%v, got=%v\n", false, cfg.Debug)
+	}
+
+	if cfg.Timeout != nil {
+		t.Fatalf("unexpected Timeout, expected=%v, got=%v\n", nil, *cfg.Timeout)
+	}
+
+	if cfg.Cache.Redis == nil || cfg.Cache.Redis.Addr != "localhost:6379" {
+		t.Fatalf("unexpected Cache.Redis, expected=%v, got=%v\n", &Redis{Addr: "localhost:6379"}, cfg.Cache.Redis)
+	}
+
+	if cfg.Cache.Memcache != nil {
+		t.Fatalf("unexpected Cache.Memcache, expected=%v, got=%v\n", nil, cfg.Cache.Memcache)
+	}
+
+	if len(cfg.Tags) != 2 || *cfg.Tags[0] != "a" || *cfg.Tags[1] != "b" {
+		t.Fatalf("unexpected Tags, expected=%v, got=%v\n", []string{"a", "b"}, cfg.Tags)
+	}
+
+	if cfg.Store == nil {
+		t.Fatal("unexpected Store, expected non-nil, got nil")
+	}
+
+	if disk := (*cfg.Store)["disk"]; disk == nil || disk.Path == nil || *disk.Path != "/var/lib/files" {
+		t.Fatalf("unexpected Store.disk, expected=%q, got=%v\n", "/var/lib/files", disk)
+	}
+
+	if cfg.Driver == nil || cfg.Driver.Docker == nil || cfg.Driver.Docker.Host != "unix:///var/run/docker.sock" {
+		t.Fatalf("unexpected Driver.Docker, expected=%q, got=%v\n", "unix:///var/run/docker.sock", cfg.Driver)
+	}
+}
+
+func Test_DecodeSchemaless(t *testing.T) {
+	expected := map[string]interface{}{
+		"name":    "server",
+		"workers": int64(4),
+		"ratio":   0.5,
+		"debug":   true,
+		"timeout": 30 * time.Second,
+		"limit":   2 * Kibibyte,
+		"net": map[string]interface{}{
+			"listen": ":443",
+			"hosts":  []interface{}{"a", "b"},
+		},
+		"log": map[string]interface{}{
+			"access": map[string]interface{}{
+				"file": "/var/log/access.log",
+			},
+			"error": map[string]interface{}{
+				"file": "/var/log/error.log",
+			},
+		},
+	}
+
+	var m map[string]interface{}
+
+	if err := DecodeFile(&m, filepath.Join("testdata", "schemaless.conf"), ErrorHandler(errh(t))); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(m, expected) {
+		t.Fatalf("decoded configuration does not match\n\texpected =%v\n\tgot = %v\n", expected, m)
+	}
+
+	var v interface{}
+
+	if err := DecodeFile(&v, filepath.Join("testdata", "schemaless.conf"), ErrorHandler(errh(t))); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(v, expected) {
+		t.Fatalf("decoded configuration does not match\n\texpected =%v\n\tgot = %v\n", expected, v)
+	}
+
+	var cfg struct {
+		Net     map[string]interface{}
+		Log     map[string]interface{}
+		Timeout interface{}
+	}
+
+	if err := DecodeFile(&cfg, filepath.Join("testdata", "schemaless.conf"), ErrorHandler(errh(t))); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(cfg.Net, expected["net"]) {
+		t.Fatalf("unexpected Net, expected=%v, got=%v\n", expected["net"], cfg.Net)
+	}
+
+	if !reflect.DeepEqual(cfg.Log, expected["log"]) {
+		t.Fatalf("unexpected Log, expected=%v, got=%v\n", expected["log"], cfg.Log)
+	}
+
+	if cfg.Timeout != 30*time.Second {
+		t.Fatalf("unexpected Timeout, expected=%v, got=%v\n", 30*time.Second, cfg.Timeout)
+	}
+}
+
+func Test_DecodeNumbers(t *testing.T) {
+	type numberCfg struct {
+		Hex       int
+		Octal     os.FileMode
+		Binary    uint8
+		Million   int64
+		Negative  int16
+		Leading   int
+		Exponent  float64
+		Separated float32
+	}
+
+	var cfg numberCfg
+
+	if err := DecodeFile(&cfg, filepath.Join("testdata", "number.conf"), ErrorHandler(errh(t))); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := numberCfg{
+		Hex:       0x1F,
+		Octal:     0o755,
+		Binary:    0b1010,
+		Million:   1000000,
+		Negative:  -0x10,
+		Leading:   755,
+		Exponent:  1e-3,
+		Separated: 1000.5,
+	}
+
+	if !reflect.DeepEqual(cfg, expected) {
+		t.Fatalf("decoded configuration does not match\n\texpected =%v\n\tgot = %v\n", expected, cfg)
+	}
+}
+
+func Test_DecodeStrings(t *testing.T) {
+	type stringCfg struct {
+		Quoted  string
+		Raw     string
+		Query   string
+		Cert    string
+		Message struct {
+			Body string
+		}
+	}
+
+	var cfg stringCfg
+
+	os.Setenv("name", "gopher")
+
+	if err := DecodeFile(&cfg, filepath.Join("testdata", "strings.conf"), ErrorHandler(errh(t)), Envvars); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := stringCfg{
+		Quoted: `say "hi"`,
+		Raw:    `C:\dir\gopher`,
+		Query:  "\nSELECT *\nFROM users",
+		Cert:   "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n",
+	}
+	expected.Message.Body = "Hello gopher,\n\n  Welcome.\n"
+
+	if !reflect.DeepEqual(cfg, expected) {
+		t.Fatalf("decoded configuration does not match\n\texpected =%#v\n\tgot = %#v\n", expected, cfg)
+	}
+}
+
+func Test_DecodeEscapedExpansion(t *testing.T) {
+	var cfg struct {
+		Template string
+		Home     string
+	}
+
+	os.Setenv("HOME", "/home/gopher")
+
+	src := `template "$${HOME} is ${HOME}"
+home     "$$${HOME}"`
+
+	if err := NewDecoder("escape.conf", ErrorHandler(errh(t)), Envvars).Decode(&cfg, strings.NewReader(src)); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "${HOME} is /home/gopher"; cfg.Template != expected {
+		t.Fatalf("unexpected Template, expected=%q, got=%q\n", expected, cfg.Template)
+	}
+
+	if expected := "$${HOME}"; cfg.Home != expected {
+		t.Fatalf("unexpected Home, expected=%q, got=%q\n", expected, cfg.Home)
+	}
+}
+
+func Test_DecodeSizes(t *testing.T) {
+	type sizeCfg struct {
+		Byte   int64
+		Kilo   int64
+		Mega   int64
+		Giga   int64
+		Tera   int64
+		Peta   int64
+		Kibi   int64
+		Mebi   int64
+		Gibi   int64
+		Tebi   int64
+		Pebi   int64
+		Legacy int64
+	}
+
+	expected := sizeCfg{
+		Byte:   1,
+		Kilo:   1000,
+		Mega:   50000000,
+		Giga:   1500000000,
+		Tera:   2000000000000,
+		Peta:   1000000000000000,
+		Kibi:   1 << 10,
+		Mebi:   50 << 20,
+		Gibi:   1 << 29,
+		Tebi:   2 << 40,
+		Pebi:   1 << 50,
+		Legacy: 1000,
+	}
+
+	var cfg sizeCfg
+
+	if err := DecodeFile(&cfg, filepath.Join("testdata", "size.conf"), ErrorHandler(errh(t))); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(cfg, expected) {
+		t.Fatalf("decoded configuration does not match\n\texpected =%v\n\tgot = %v\n", expected, cfg)
+	}
+
+	if err := DecodeFile(&cfg, filepath.Join("testdata", "size.conf"), ErrorHandler(errh(t)), LegacySizes); err != nil {
+		t.Fatal(err)
+	}
+
+	expected.Mega = 50 << 20
+	expected.Giga = 3 << 29
+	expected.Tera = 2 << 40
+	expected.Peta = 1 << 50
+	expected.Legacy = 1 << 10
+
+	if !reflect.DeepEqual(cfg, expected) {
+		t.Fatalf("decoded configuration does not match\n\texpected =%v\n\tgot = %v\n", expected, cfg)
+	}
+
+	err := NewDecoder("size.conf", ErrorHandler(errh(t))).Decode(&cfg, strings.NewReader("byte 1.5B"))
+
+	decerr, ok := err.(*DecodeError)
+
+	if !ok {
+		t.Fatalf("unexpected error type, expected=%T, got=%T\n", decerr, err)
+	}
+
+	if expected := "size.conf,1:6 - size 1.5B is not a whole number of bytes"; decerr.Err == nil || decerr.Err.Error() != expected {
+		t.Fatalf("unexpected error, expected=%q, got=%q\n", expected, decerr.Err)
+	}
+}
+
+func Test_DecodeSizeDuration(t *testing.T) {
+	var cfg struct {
+		Timeout time.Duration
+		Wait    Duration
+		Limit   Size
+	}
+
+	tests := []struct {
+		src string
+		err string
+	}{
+		{"timeout 1m30s", ""},
+		{"wait 1.5h", ""},
+		{"limit 50MB", ""},
+		{"timeout 50MB", `config: types.conf,1:9 - cannot decode "timeout" into field Timeout of type time.Duration: cannot use size as time.Duration`},
+		{"wait 1KiB", `config: types.conf,1:6 - cannot decode "wait" into field Wait of type config.Duration: cannot use size as config.Duration`},
+		{"limit 1h", `config: types.conf,1:7 - cannot decode "limit" into field Limit of type config.Size: cannot use duration as config.Size`},
+	}
+
+	for _, test := range tests {
+		err := NewDecoder("types.conf", ErrorHandler(errh(t))).Decode(&cfg, strings.NewReader(test.src))
+
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%q: unexpected error: %s\n", test.src, err)
+			}
+			continue
+		}
+
+		if err == nil || err.Error() != test.err {
+			t.Errorf("%q: unexpected error, expected=%q, got=%v\n", test.src, test.err, err)
+		}
+	}
+}
+
+func Test_DecodeErrorPath(t *testing.T) {
+	type TLS struct {
+		CA   string
+		Port int
+	}
+
+	var cfg struct {
+		Auth struct {
+			LDAP struct {
+				TLS TLS
+			}
+		}
+
+		Upstream map[string]struct {
+			Port int
+		}
+
+		Servers []struct {
+			Port int
+		}
+
+		Ports  []int
+		Matrix [][]int
+	}
+
+	tests := []struct {
+		src   string
+		path  string
+		param string
+		pos   string
+		err   string
+	}{
+		{
+			"auth {\n\tldap {\n\t\ttls {\n\t\t\tca 10\n\t\t}\n\t}\n}",
+			"auth.ldap.tls.ca",
+			"ca",
+			"path.conf,4:7",
+			`config: path.conf,4:7 - cannot decode "auth.ldap.tls.ca" into field CA of type string: cannot use int as string`,
+		},
+		{
+			"upstream api {\n\tport \"80\"\n}",
+			"upstream.api.port",
+			"port",
+			"path.conf,2:7",
+			`config: path.conf,2:7 - cannot decode "upstream.api.port" into field Port of type int: cannot use string as int`,
+		},
+		{
+			"servers [{\n\tport 80\n}, {\n\tport true\n}]",
+			"servers[1].port",
+			"port",
+			"path.conf,4:7",
+			`config: path.conf,4:7 - cannot decode "servers[1].port" into field Port of type int: cannot use bool as int`,
+		},
+		{
+			"ports [80, \"443\"]",
+			"ports[1]",
+			"ports",
+			"path.conf,1:12",
+			`config: path.conf,1:12 - cannot decode "ports[1]" into int: cannot use string as int`,
+		},
+		{
+			"matrix [[1], [2, true]]",
+			"matrix[1][1]",
+			"matrix",
+			"path.conf,1:18",
+			`config: path.conf,1:18 - cannot decode "matrix[1][1]" into int: cannot use bool as int`,
+		},
+	}
+
+	for _, test := range tests {
+		err := NewDecoder("path.conf", ErrorHandler(errh(t))).Decode(&cfg, strings.NewReader(test.src))
+
+		var decerr *DecodeError
+
+		if !errors.As(err, &decerr) {
+			t.Fatalf("%q: unexpected error type, expected=%T, got=%T\n", test.src, decerr, err)
+		}
+
+		if decerr.Path != test.path {
+			t.Errorf("%q: unexpected Path, expected=%q, got=%q\n", test.src, test.path, decerr.Path)
+		}
+
+		if decerr.Param != test.param {
+			t.Errorf("%q: unexpected Param, expected=%q, got=%q\n", test.src, test.param, decerr.Param)
+		}
+
+		if pos := decerr.Pos.String(); pos != test.pos {
+			t.Errorf("%q: unexpected Pos, expected=%q, got=%q\n", test.src, test.pos, pos)
+		}
+
+		if err.Error() != test.err {
+			t.Errorf("%q: unexpected error, expected=%q, got=%q\n", test.src, test.err, err.Error())
+		}
+
+		var cause *Error
+
+		if !errors.As(err, &cause) || cause.Pos != decerr.Pos {
+			t.Errorf("%q: expected cause at %s, got=%v\n", test.src, decerr.Pos, cause)
+		}
+	}
+}
+
+func Test_DecodeStrict(t *testing.T) {
+	type Config struct {
+		Net struct {
+			Listen string
+		}
+
+		Store struct {
+			SFTP struct {
+				Addr string
+			}
+		} `config:",nogroup"`
+
+		Plugins struct{} `config:",nostrict"`
+
+		Cache struct {
+			Redis struct {
+				Addr string
+			}
+		} `config:",strict"`
+
+		BodyLimit int64 `config:"body_limit"`
+	}
+
+	var cfg Config
+
+	// Without the Strict option, only the field with the strict option should
+	// report unknown parameters.
+	err := DecodeFile(&cfg, filepath.Join("testdata", "strict.conf"), ErrorHandler(errh(t)))
+
+	if expected := "testdata/strict.conf,22:3 - unknown parameter cache.redis.adr"; err == nil || err.Error() != expected {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", expected, err)
+	}
+
+	cfg = Config{}
+
+	err = DecodeFile(&cfg, filepath.Join("testdata", "strict.conf"), ErrorHandler(errh(t)), Strict)
+
+	expected := []string{
+		"testdata/strict.conf,3:2 - unknown parameter net.lisen",
+		"testdata/strict.conf,10:7 - unknown label store.ftp",
+		"testdata/strict.conf,22:3 - unknown parameter cache.redis.adr",
+		"testdata/strict.conf,26:1 - unknown parameter body_limt",
+	}
+
+	checkerrs(t, err, expected)
+
+	if cfg.Net.Listen != ":https" {
+		t.Errorf("unexpected Net.Listen, expected=%q, got=%q\n", ":https", cfg.Net.Listen)
+	}
+
+	// Errors should also be returned when not decoding into a struct.
+	tests := []struct {
+		v   interface{}
+		src string
+		err string
+	}{
+		{
+			&map[string]struct{ Name string }{},
+			`a { nmae "x" }`,
+			"strict.conf,1:5 - unknown parameter a.nmae",
+		},
+		{
+			&map[string]struct {
+				Path string `config:",required"`
+			}{},
+			`a { }`,
+			"strict.conf,1:3 - missing required parameter a.path",
+		},
+	}
+
+	for i, test := range tests {
+		err := NewDecoder("strict.conf", ErrorHandler(errh(t)), Strict).Decode(test.v, strings.NewReader(test.src))
+
+		if err == nil || err.Error() != test.err {
+			t.Errorf("tests[%d] - unexpected error, expected=%q, got=%v\n", i, test.err, err)
+		}
+	}
+}
+
+func Test_DecodeRequired(t *testing.T) {
+	var cfg struct {
+		Name string `config:",required"`
+
+		Net struct {
+			TLS struct {
+				Cert string `config:",required"`
+				Key  string `config:",required"`
+			}
+		} `config:",required"`
+
+		Log map[string]struct {
+			Level string
+			File  string `config:",required"`
+		}
+
+		Upstreams []struct {
+			Addr   string `config:",required"`
+			Weight int
+		}
+	}
+
+	err := DecodeFile(&cfg, filepath.Join("testdata", "required.conf"), ErrorHandler(errh(t)))
+
+	expected := []string{
+		"testdata/required.conf - missing required parameter name",
+		"testdata/required.conf,2:6 - missing required parameter net.tls.key",
+		"testdata/required.conf,7:12 - missing required parameter log.access.file",
+		"testdata/required.conf,18:4 - missing required parameter upstreams[1].addr",
+	}
+
+	checkerrs(t, err, expected)
+
+	var drivers struct {
+		Driver struct {
+			Docker struct {
+				Host string
+			}
+
+			SSH struct {
+				Addr string
+			} `config:"ssh,required"`
+		} `config:",nogroup"`
+	}
+
+	srcs := []string{
+		"driver docker {\n\thost \"unix:///var/run/docker.sock\"\n}",
+		"",
+	}
+
+	for _, src := range srcs {
+		err = NewDecoder("required.conf", ErrorHandler(errh(t))).Decode(&drivers, strings.NewReader(src))
+
+		if expected := "required.conf - missing required parameter driver.ssh"; err == nil || err.Error() != expected {
+			t.Errorf("%q: unexpected error, expected=%q, got=%v\n", src, expected, err)
+		}
+	}
+}
+
+func Test_DecodeDefaults(t *testing.T) {
+	type Log struct {
+		Level string `default:"info"`
+		File  string
+	}
+
+	type Upstream struct {
+		Addr   string
+		Weight int `default:"1"`
+	}
+
+	type Config struct {
+		Listen    string   `default:":http"`
+		BodyLimit int64    `config:"body_limit" default:"50MB"`
+		Ciphers   []string `default:"[\"AES-128SHA256\", \"AES-256SHA256\"]"`
+		Workers   *int     `default:"4"`
+		Quoted    string   `default:"\"a \\\"quoted\\\" string\""`
+
+		Timeout struct {
+			Read  time.Duration `default:"10s"`
+			Write time.Duration `default:"1h30m"`
+		}
+
+		Log       map[string]Log
+		Upstreams []Upstream
+	}
+
+	var cfg Config
+
+	if err := DecodeFile(&cfg, filepath.Join("testdata", "default.conf"), ErrorHandler(errh(t))); err != nil {
+		t.Fatal(err)
+	}
+
+	workers := 4
+
+	expected := Config{
+		Listen:    ":https",
+		Quoted:    "a \"quoted\" string",
+		BodyLimit: 50 * 1000 * 1000,
+		Ciphers:   []string{"AES-128SHA256", "AES-256SHA256"},
+		Workers:   &workers,
+		Log: map[string]Log{
+			"access": {Level: "info", File: "/var/log/http/access.log"},
+			"error":  {Level: "error", File: "/var/log/http/error.log"},
+		},
+		Upstreams: []Upstream{
+			{Addr: "10.0.0.2", Weight: 1},
+			{Addr: "10.0.0.3", Weight: 2},
+		},
+	}
+
+	expected.Timeout.Read = 10 * time.Second
+	expected.Timeout.Write = time.Hour + 30*time.Minute
+
+	if !reflect.DeepEqual(cfg, expected) {
+		t.Fatalf("decoded configuration does not match\n\texpected =%v\n\tgot = %v\n", expected, cfg)
+	}
+
+	var drivers struct {
+		Driver struct {
+			Docker struct {
+				Host string
+			}
+
+			QEMU struct {
+				CPUs int `default:"2"`
+			}
+		} `config:",nogroup"`
+	}
+
+	src := "driver docker {\n\thost \"unix:///var/run/docker.sock\"\n}"
+
+	if err := NewDecoder("default.conf", ErrorHandler(errh(t))).Decode(&drivers, strings.NewReader(src)); err != nil {
+		t.Fatal(err)
+	}
+
+	if drivers.Driver.QEMU.CPUs != 2 {
+		t.Errorf("unexpected Driver.QEMU.CPUs, expected=%d, got=%d\n", 2, drivers.Driver.QEMU.CPUs)
+	}
+
+	var sizes struct {
+		Limit Size `default:"1MB"`
+	}
+
+	if err := NewDecoder("default.conf", ErrorHandler(errh(t)), LegacySizes).Decode(&sizes, strings.NewReader("")); err != nil {
+		t.Fatal(err)
+	}
+
+	if sizes.Limit != Mebibyte {
+		t.Errorf("unexpected Limit, expected=%s, got=%s\n", Mebibyte, sizes.Limit)
+	}
+
+	var bad struct {
+		Timeout struct {
+			Read time.Duration `default:"\"10s\""`
+		}
+	}
+
+	err := NewDecoder("default.conf", ErrorHandler(errh(t))).Decode(&bad, strings.NewReader(""))
+
+	expectedErr := `config: default.conf - cannot decode "timeout.read" into field Read of type time.Duration: default,1:1 - cannot use string as int64`
+
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", expectedErr, err)
+	}
+}
+
+var errNoKey = errors.New("cert without key")
+
+type validateTLS struct {
+	Cert string
+	Key  string
+}
+
+func (t validateTLS) Validate() error {
+	if t.Cert != "" && t.Key == "" {
+		return errNoKey
+	}
+	return nil
+}
+
+type validatePort int
+
+func (p validatePort) Validate() error {
+	if p < 1 || p > 65535 {
+		return errors.New("port out of range")
+	}
+	return nil
+}
+
+// validateHost normalises the host in its Validate method, to check that the
+// changes made with a pointer receiver are kept.
+type validateHost string
+
+func (h *validateHost) Validate() error {
+	*h = validateHost(strings.ToLower(string(*h)))
+	return nil
+}
+
+type validateConfig struct {
+	Net struct {
+		Listen string
+		TLS    validateTLS
+	}
+
+	Port validatePort
+	Host validateHost
+
+	validated bool
+}
+
+func (c *validateConfig) Validate() error {
+	c.validated = true
+
+	if c.Net.Listen == "" {
+		return errors.New("no listen address")
+	}
+	return nil
+}
+
+func Test_DecodeValidate(t *testing.T) {
+	var cfg validateConfig
+
+	err := DecodeFile(&cfg, filepath.Join("testdata", "validate.conf"), ErrorHandler(errh(t)))
+
+	if !errors.Is(err, errNoKey) {
+		t.Fatalf("unexpected error, expected=%q, got=%v\n", errNoKey, err)
+	}
+
+	var decerr *DecodeError
+
+	if !errors.As(err, &decerr) {
+		t.Fatalf("unexpected error type, expected=%T, got=%T\n", decerr, err)
+	}
+
+	if expected := "testdata/validate.conf,4:6"; decerr.Pos.String() != expected {
+		t.Errorf("unexpected Pos, expected=%q, got=%q\n", expected, decerr.Pos)
+	}
+
+	if expected := "net.tls"; decerr.Path != expected {
+		t.Errorf("unexpected Path, expected=%q, got=%q\n", expected, decerr.Path)
+	}
+
+	if cfg.validated {
+		t.Errorf("expected config to not be validated after error in tls block\n")
+	}
+
+	tests := []struct {
+		src string
+		err string
+	}{
+		{
+			"net {\n\tlisten \":https\"\n}",
+			"",
+		},
+		{
+			"port 0",
+			`config: validate.conf,1:6 - cannot decode "port" into field Port of type config.validatePort: port out of range`,
+		},
+		{
+			"port 80",
+			"config: validate.conf - cannot decode into config.validateConfig: no listen address",
+		},
+	}
+
+	for _, test := range tests {
+		cfg = validateConfig{}
+
+		err := NewDecoder("validate.conf", ErrorHandler(errh(t))).Decode(&cfg, strings.NewReader(test.src))
+
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%q: unexpected error: %s\n", test.src, err)
+			}
+			if !cfg.validated {
+				t.Errorf("%q: expected config to be validated\n", test.src)
+			}
+			continue
+		}
+
+		if err == nil || err.Error() != test.err {
+			t.Errorf("%q: unexpected error, expected=%q, got=%v\n", test.src, test.err, err)
+		}
+
+		if !errors.As(err, &decerr) {
+			t.Errorf("%q: unexpected error type, expected=%T, got=%T\n", test.src, decerr, err)
+		}
+	}
+
+	cfg = validateConfig{}
+
+	src := "net {\n\tlisten \":https\"\n}\nhost \"Example.COM\""
+
+	if err := NewDecoder("validate.conf", ErrorHandler(errh(t))).Decode(&cfg, strings.NewReader(src)); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := validateHost("example.com"); cfg.Host != expected {
+		t.Errorf("unexpected Host, expected=%q, got=%q\n", expected, cfg.Host)
+	}
+}
+
+func Test_DecodeDeps(t *testing.T) {
+	var cfg struct {
+		TLS struct {
+			Cert string `config:"cert,requires=key"`
+			Key  string
+		}
+
+		Cache struct {
+			Redis     string `config:"redis,conflicts=memcached"`
+			Memcached string `config:"memcached,conflicts=redis"`
+		}
+
+		Store struct {
+			Path string `config:"path,oneof-group=source"`
+			Addr string `config:"addr,oneof-group=source"`
+		}
+
+		Upstream struct {
+			Addr   string `config:"addr,oneof-group=target"`
+			Socket string `config:"socket,oneof-group=target"`
+			Weight int
+		}
+	}
+
+	err := DecodeFile(&cfg, filepath.Join("testdata", "deps.conf"), ErrorHandler(errh(t)))
+
+	expected := []string{
+		"testdata/deps.conf,2:2 - tls.cert requires tls.key",
+		"testdata/deps.conf,7:2 - cache.memcached conflicts with cache.redis at testdata/deps.conf,6:2",
+		"testdata/deps.conf,12:2 - store.addr conflicts with store.path at testdata/deps.conf,11:2",
+		"testdata/deps.conf,15:10 - one of upstream.addr, upstream.socket is required",
+	}
+
+	checkerrs(t, err, expected)
+}
+
+func Test_DecodeDuplicates(t *testing.T) {
+	type Log struct {
+		Level string
+		File  string
+	}
+
+	type Config struct {
+		Listen string
+
+		Net struct {
+			Timeout time.Duration
+
+			TLS struct {
+				Cert string
+				Key  string
+			}
+		}
+
+		Log map[string]Log
+	}
+
+	name := filepath.Join("testdata", "duplicate.conf")
+
+	var cfg Config
+
+	if err := DecodeFile(&cfg, name, ErrorHandler(errh(t)), Includes); err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Listen != ":https" {
+		t.Errorf("unexpected Listen, expected=%q, got=%q\n", ":https", cfg.Listen)
+	}
+
+	if cfg.Net.Timeout != 0 || cfg.Net.TLS.Key != "" {
+		t.Errorf("expected last net block to win, got=%v\n", cfg.Net)
+	}
+
+	if expected := (Log{File: "/var/log/http/access.log"}); cfg.Log["access"] != expected {
+		t.Errorf("unexpected Log.access, expected=%v, got=%v\n", expected, cfg.Log["access"])
+	}
+
+	expected := []string{
+		"testdata/duplicate.conf,3:1 - duplicate parameter listen, previously given at testdata/duplicate_include.conf,1:1",
+		"testdata/duplicate.conf,5:1 - duplicate parameter net, previously given at testdata/duplicate_include.conf,3:1",
+		"testdata/duplicate.conf,15:1 - duplicate parameter log.access, previously given at testdata/duplicate.conf,11:1",
+	}
+
+	cfg = Config{}
+
+	err := DecodeFile(&cfg, name, ErrorHandler(errh(t)), Includes, Duplicates(DuplicateError))
+
+	checkerrs(t, err, expected)
+
+	warnings := make([]string, 0)
+
+	warn := func(pos Pos, msg string) {
+		warnings = append(warnings, pos.String()+" - "+msg)
+	}
+
+	cfg = Config{}
+
+	if err := DecodeFile(&cfg, name, ErrorHandler(warn), Includes, Duplicates(DuplicateWarn)); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(warnings, expected) {
+		t.Errorf("unexpected warnings\n\texpected=%v\n\tgot=%v\n", expected, warnings)
+	}
+
+	cfg = Config{}
+
+	if err := DecodeFile(&cfg, name, ErrorHandler(errh(t)), Includes, Duplicates(DuplicateMerge)); err != nil {
+		t.Fatal(err)
+	}
+
+	merged := Config{
+		Listen: ":https",
+		Log: map[string]Log{
+			"access": {Level: "info", File: "/var/log/http/access.log"},
+		},
+	}
+
+	merged.Net.Timeout = 10 * time.Second
+	merged.Net.TLS.Cert = "/var/lib/ssl/server.crt"
+	merged.Net.TLS.Key = "/var/lib/ssl/server.key"
+
+	if !reflect.DeepEqual(cfg, merged) {
+		t.Fatalf("decoded configuration does not match\n\texpected =%v\n\tgot = %v\n", merged, cfg)
+	}
+
+	// Duplicates should also be reported when not decoding into a struct.
+	targets := []interface{}{
+		&map[string]interface{}{},
+		&map[string]int{},
+		new(interface{}),
+	}
+
+	for i, v := range targets {
+		err := NewDecoder("duplicate.conf", ErrorHandler(errh(t)), Duplicates(DuplicateError)).Decode(v, strings.NewReader("a 1\na 2"))
+
+		if expected := "duplicate.conf,2:1 - duplicate parameter a, previously given at duplicate.conf,1:1"; err == nil || err.Error() != expected {
+			t.Errorf("targets[%d] - unexpected error, expected=%q, got=%v\n", i, expected, err)
+		}
+	}
+}
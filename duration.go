@@ -0,0 +1,76 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"time"
+)
+
+// Duration is a time.Duration whose String method returns a duration literal,
+// so durations can be encoded, and marshalled in a human readable way.
+type Duration time.Duration
+
+var configDurationType = reflect.TypeOf(Duration(0))
+
+// ParseDuration parses a duration literal, such as 1h30m, or 1.5d.
+func ParseDuration(s string) (Duration, error) {
+	d, err := parseDuration(s)
+
+	if err != nil {
+		return 0, errors.New("config: " + err.Error())
+	}
+	return Duration(d), nil
+}
+
+// Duration returns the duration as a time.Duration.
+func (d Duration) Duration() time.Duration {
+	return time.Duration(d)
+}
+
+// String returns the duration as a duration literal.
+func (d Duration) String() string {
+	return formatDuration(time.Duration(d))
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (d *Duration) UnmarshalText(b []byte) error {
+	v, err := ParseDuration(string(b))
+
+	if err != nil {
+		return err
+	}
+
+	*d = v
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler. The duration is marshalled as a
+// string containing the duration literal.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler. This accepts either a string
+// containing a duration literal, or a number of nanoseconds.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+
+	if err := json.Unmarshal(b, &s); err == nil {
+		return d.UnmarshalText([]byte(s))
+	}
+
+	var n int64
+
+	if err := json.Unmarshal(b, &n); err != nil {
+		return errors.New("config: cannot unmarshal " + string(b) + " into Duration")
+	}
+
+	*d = Duration(n)
+	return nil
+}
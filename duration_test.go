@@ -0,0 +1,70 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func Test_DurationString(t *testing.T) {
+	tests := []struct {
+		dur      Duration
+		expected string
+	}{
+		{0, "0s"},
+		{Duration(time.Hour + 30*time.Minute), "1h30m"},
+		{Duration(36 * time.Hour), "36h"},
+		{Duration(1500 * time.Millisecond), "1.5s"},
+		{Duration(500 * time.Millisecond), "500ms"},
+		{Duration(250 * time.Microsecond), "250us"},
+		{Duration(5), "5ns"},
+		{Duration(-time.Minute), "-1m"},
+	}
+
+	for _, test := range tests {
+		if s := test.dur.String(); s != test.expected {
+			t.Errorf("Duration(%d) - unexpected String, expected=%q, got=%q\n", int64(test.dur), test.expected, s)
+		}
+
+		dur, err := ParseDuration(test.expected)
+
+		if err != nil {
+			t.Errorf("Duration(%d) - %s\n", int64(test.dur), err)
+			continue
+		}
+
+		if dur != test.dur {
+			t.Errorf("%q - unexpected ParseDuration, expected=%d, got=%d\n", test.expected, int64(test.dur), int64(dur))
+		}
+	}
+}
+
+func Test_DurationJSON(t *testing.T) {
+	var v struct {
+		Timeout Duration
+	}
+
+	v.Timeout = Duration(90 * time.Second)
+
+	b, err := json.Marshal(v)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := `{"Timeout":"1m30s"}`; string(b) != expected {
+		t.Fatalf("unexpected json, expected=%q, got=%q\n", expected, string(b))
+	}
+
+	for _, src := range []string{`{"Timeout":"1m30s"}`, `{"Timeout":90000000000}`} {
+		v.Timeout = 0
+
+		if err := json.Unmarshal([]byte(src), &v); err != nil {
+			t.Fatal(err)
+		}
+
+		if v.Timeout != Duration(90*time.Second) {
+			t.Fatalf("%s - unexpected Timeout, expected=%s, got=%s\n", src, Duration(90*time.Second), v.Timeout)
+		}
+	}
+}
@@ -0,0 +1,512 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// Editor edits the parameters of a configuration source in place. Only the
+// parts of the source that are changed by an edit are rewritten, everything
+// else, including comments and formatting, is preserved.
+//
+// Parameters are referred to by their path, this is a dot separated list of
+// parameter names. Labels are given as part of the path after the name of the
+// parameter they label, for example the path "auth.ldap.tls.ca" would refer to
+// the ca parameter in the following,
+//
+//	auth ldap {
+//		tls {
+//			ca "/var/lib/ssl/ca.crt"
+//		}
+//	}
+type Editor struct {
+	name string
+	src  []byte
+	file *File
+}
+
+// NewEditor returns an editor for the given configuration source. The name is
+// used to identify the source in any errors, and is the name of the file that
+// is written to on Save.
+func NewEditor(name string, src []byte) (*Editor, error) {
+	e := &Editor{
+		name: name,
+	}
+
+	if err := e.reset(src); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// EditFile returns an editor for the given configuration file.
+func EditFile(name string) (*Editor, error) {
+	src, err := os.ReadFile(name)
+
+	if err != nil {
+		return nil, err
+	}
+	return NewEditor(name, src)
+}
+
+// reset parses the given source and uses it as the source for the editor if
+// it is valid.
+func (e *Editor) reset(src []byte) error {
+	f, err := Parse(e.name, bytes.NewReader(src))
+
+	if err != nil {
+		return err
+	}
+
+	e.src = src
+	e.file = f
+	return nil
+}
+
+// Bytes returns the edited source.
+func (e *Editor) Bytes() []byte {
+	return e.src
+}
+
+// WriteTo writes the edited source to the given writer.
+func (e *Editor) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(e.src)
+	return int64(n), err
+}
+
+// Save writes the edited source back to the file the editor was created with.
+func (e *Editor) Save() error {
+	mode := os.FileMode(0644)
+
+	if info, err := os.Stat(e.name); err == nil {
+		mode = info.Mode().Perm()
+	}
+	return os.WriteFile(e.name, e.src, mode)
+}
+
+func splitPath(path string) []string {
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, ".")
+}
+
+// lookup returns the parameter with the given path in the list of parameters.
+// If a parameter appears multiple times, then the last one is returned, since
+// that is the one that would be decoded.
+func lookup(params []*Param, path []string) *Param {
+	for i := len(params) - 1; i >= 0; i-- {
+		p := params[i]
+
+		if p.Name.Value != path[0] {
+			continue
+		}
+
+		rest := path[1:]
+
+		if p.Label != nil {
+			if len(rest) == 0 || p.Label.Value != rest[0] {
+				continue
+			}
+			rest = rest[1:]
+		}
+
+		if len(rest) == 0 {
+			return p
+		}
+
+		if b, ok := p.Value.(*Block); ok {
+			if found := lookup(b.Params, rest); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+// block returns the block of the parameter with the given path. If the path
+// is empty then nil is returned for the top-level of the file.
+func (e *Editor) block(path []string) (*Block, error) {
+	if len(path) == 0 {
+		return nil, nil
+	}
+
+	p := lookup(e.file.Params, path)
+
+	if p == nil {
+		return nil, errors.New("config: no parameter " + strings.Join(path, "."))
+	}
+
+	b, ok := p.Value.(*Block)
+
+	if !ok {
+		return nil, errors.New("config: parameter " + strings.Join(path, ".") + " is not a block")
+	}
+	return b, nil
+}
+
+// lineStart returns the offset of the start of the line containing the given
+// offset.
+func (e *Editor) lineStart(off int) int {
+	return bytes.LastIndexByte(e.src[:off], '\n') + 1
+}
+
+// lineEnd returns the offset immediately after the newline of the line
+// containing the given offset.
+func (e *Editor) lineEnd(off int) int {
+	i := bytes.IndexByte(e.src[off:], '\n')
+
+	if i < 0 {
+		return len(e.src)
+	}
+	return off + i + 1
+}
+
+// indentation returns the leading whitespace of the line containing the given
+// offset.
+func (e *Editor) indentation(off int) string {
+	start := e.lineStart(off)
+	end := start
+
+	for end < len(e.src) && (e.src[end] == ' ' || e.src[end] == '\t') {
+		end++
+	}
+	return string(e.src[start:end])
+}
+
+// trimSpace returns the offset of the start of the spaces, and tabs that come
+// before the given offset on the same line.
+func (e *Editor) trimSpace(off int) int {
+	for off > 0 && (e.src[off-1] == ' ' || e.src[off-1] == '\t') {
+		off--
+	}
+	return off
+}
+
+func isBlank(b []byte) bool {
+	return len(bytes.TrimSpace(b)) == 0
+}
+
+// indent prefixes every line after the first in the given text with the given
+// indentation.
+func indent(text []byte, indent string) []byte {
+	return bytes.ReplaceAll(text, []byte("\n"), []byte("\n"+indent))
+}
+
+// replace replaces the source between the two offsets with the given text.
+func (e *Editor) replace(start, end int, text []byte) error {
+	src := make([]byte, 0, len(e.src)-(end-start)+len(text))
+	src = append(src, e.src[:start]...)
+	src = append(src, text...)
+	src = append(src, e.src[end:]...)
+
+	return e.reset(src)
+}
+
+// blockAt returns the block that opens at the given offset.
+func (e *Editor) blockAt(off int) *Block {
+	var b *Block
+
+	Inspect(e.file, func(n Node) bool {
+		if v, ok := n.(*Block); ok && v.Pos().Offset == off {
+			b = v
+		}
+		return b == nil
+	})
+	return b
+}
+
+// explode puts each parameter that is on the same line as the opening brace
+// of the block on a line of its own, along with the closing brace if it is on
+// that line too. The block from the new source is returned.
+func (e *Editor) explode(b *Block) (*Block, error) {
+	line := b.Pos().Line
+	parent := e.indentation(b.Pos().Offset)
+	child := parent + "\t"
+
+	end := b.Pos().Offset + 1
+
+	src := make([]byte, 0, len(e.src))
+	src = append(src, e.src[:end]...)
+
+	for _, p := range b.Params {
+		if p.Pos().Line != line {
+			break
+		}
+
+		end = p.End().Offset
+
+		if p.Comment != nil {
+			end = p.Comment.End().Offset
+		}
+
+		src = append(src, "\n"+child...)
+		src = append(src, e.src[p.Pos().Offset:end]...)
+	}
+
+	if b.Rbrace.Line == line {
+		src = append(src, "\n"+parent...)
+		src = append(src, e.src[b.Rbrace.Offset:]...)
+	} else {
+		// Drop the separator after the last parameter that was moved.
+		for end < len(e.src) && (e.src[end] == ' ' || e.src[end] == '\t' || e.src[end] == ';') {
+			end++
+		}
+		src = append(src, e.src[end:]...)
+	}
+
+	if err := e.reset(src); err != nil {
+		return nil, err
+	}
+	return e.blockAt(b.Pos().Offset), nil
+}
+
+// insert appends the given parameter text to the end of the block, or to the
+// end of the file if the block is nil.
+func (e *Editor) insert(b *Block, text []byte) error {
+	text = bytes.TrimSuffix(text, []byte("\n"))
+
+	// Break up a block with parameters on the same line as its opening
+	// brace, so the new parameter is not the only one on a line of its own.
+	if b != nil && len(b.Params) > 0 && b.Params[0].Pos().Line == b.Pos().Line {
+		var err error
+
+		if b, err = e.explode(b); err != nil {
+			return err
+		}
+	}
+
+	var (
+		params []*Param
+		parent string
+	)
+
+	if b != nil {
+		params = b.Params
+		parent = e.indentation(b.Pos().Offset)
+	} else {
+		params = e.file.Params
+	}
+
+	if len(params) == 0 {
+		if b == nil {
+			var buf bytes.Buffer
+
+			buf.Write(e.src)
+
+			if len(e.src) > 0 && !bytes.HasSuffix(e.src, []byte("\n")) {
+				buf.WriteByte('\n')
+			}
+
+			buf.Write(text)
+			buf.WriteByte('\n')
+
+			return e.reset(buf.Bytes())
+		}
+
+		child := parent + "\t"
+
+		// The block is on a single line, so break it up around the new
+		// parameter.
+		if b.Pos().Line == b.Rbrace.Line {
+			text = append([]byte("\n"+child), indent(text, child)...)
+			text = append(text, "\n"+parent...)
+
+			return e.replace(e.trimSpace(b.Rbrace.Offset), b.Rbrace.Offset, text)
+		}
+
+		off := e.lineStart(b.Rbrace.Offset)
+
+		text = append([]byte(child), indent(text, child)...)
+		text = append(text, '\n')
+
+		return e.replace(off, off, text)
+	}
+
+	last := params[len(params)-1]
+
+	end := last.End()
+
+	if last.Comment != nil {
+		end = last.Comment.End()
+	}
+
+	child := e.indentation(last.Pos().Offset)
+
+	// The closing brace is on the same line as the last parameter, so put the
+	// new parameter on a line between them.
+	if b != nil && b.Rbrace.Line == end.Line {
+		text = append([]byte("\n"+child), indent(text, child)...)
+		text = append(text, "\n"+parent...)
+
+		return e.replace(e.trimSpace(b.Rbrace.Offset), b.Rbrace.Offset, text)
+	}
+
+	var buf bytes.Buffer
+
+	off := e.lineEnd(end.Offset)
+
+	if off == len(e.src) && !bytes.HasSuffix(e.src, []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+
+	// Separate parameters that span multiple lines with a blank line.
+	if bytes.IndexByte(text, '\n') >= 0 || last.Pos().Line != end.Line {
+		buf.WriteByte('\n')
+	}
+
+	buf.WriteString(child)
+	buf.Write(indent(text, child))
+	buf.WriteByte('\n')
+
+	return e.replace(off, off, buf.Bytes())
+}
+
+// Set sets the value of the parameter at the given path to the configuration
+// encoding of v. If the parameter does not exist, then it is added to the end
+// of the block it would be in, this block must already exist.
+func (e *Editor) Set(path string, v interface{}) error {
+	parts := splitPath(path)
+
+	if len(parts) == 0 {
+		return errors.New("config: empty path")
+	}
+
+	name := parts[len(parts)-1]
+
+	if !isIdent(name) {
+		return errors.New("config: invalid parameter name " + name)
+	}
+
+	p := lookup(e.file.Params, parts)
+
+	if p == nil {
+		b, err := e.block(parts[:len(parts)-1])
+
+		if err != nil {
+			return err
+		}
+
+		text, err := encodeParam(name, "", reflect.ValueOf(v))
+
+		if err != nil {
+			return err
+		}
+		return e.insert(b, text)
+	}
+
+	var label string
+
+	if p.Label != nil {
+		label = p.Label.Value
+	}
+
+	text, err := encodeParam(p.Name.Value, label, reflect.ValueOf(v))
+
+	if err != nil {
+		return err
+	}
+
+	// Only keep the encoded value, so any alignment between the name and
+	// the existing value is preserved.
+	text = bytes.TrimSuffix(text[len(paramKey(p))+1:], []byte("\n"))
+	text = indent(text, e.indentation(p.Pos().Offset))
+
+	if p.Value == nil {
+		end := p.End().Offset
+		return e.replace(end, end, append([]byte(" "), text...))
+	}
+	return e.replace(p.Value.Pos().Offset, p.Value.End().Offset, text)
+}
+
+// Add adds the parameters in the given source to the end of the block at the
+// given path. If the path is empty, then the parameters are added to the end
+// of the file.
+func (e *Editor) Add(path string, src string) error {
+	b, err := e.block(splitPath(path))
+
+	if err != nil {
+		return err
+	}
+
+	text, err := Format(e.name, []byte(src))
+
+	if err != nil {
+		return err
+	}
+
+	if len(text) == 0 {
+		return nil
+	}
+	return e.insert(b, text)
+}
+
+// Delete removes the parameter at the given path, along with its comments.
+func (e *Editor) Delete(path string) error {
+	parts := splitPath(path)
+
+	if len(parts) == 0 {
+		return errors.New("config: empty path")
+	}
+
+	p := lookup(e.file.Params, parts)
+
+	if p == nil {
+		return errors.New("config: no parameter " + path)
+	}
+
+	start := p.Pos().Offset
+
+	if p.Doc != nil {
+		start = p.Doc.Pos().Offset
+	}
+
+	end := p.End().Offset
+
+	if p.Comment != nil {
+		end = p.Comment.End().Offset
+	} else if end < len(e.src) && e.src[end] == ';' {
+		end++
+	}
+
+	// Remove the lines the parameter is on if there is nothing else on them.
+	if ls, le := e.lineStart(start), e.lineEnd(end); isBlank(e.src[ls:start]) && isBlank(e.src[end:le]) {
+		start, end = ls, le
+
+		// Collapse the blank lines that would be left either side of the
+		// parameter, or at the end of the file.
+		if start > 0 {
+			prev := e.lineStart(start - 1)
+
+			if isBlank(e.src[prev:start]) && (end == len(e.src) || isBlank(e.src[end:e.lineEnd(end)])) {
+				start = prev
+			}
+		}
+
+		// Don't leave a blank line directly after an opening brace.
+		if start > 0 && end < len(e.src) {
+			line := bytes.TrimSpace(e.src[e.lineStart(start-1):start])
+
+			if bytes.HasSuffix(line, []byte("{")) && isBlank(e.src[end:e.lineEnd(end)]) {
+				end = e.lineEnd(end)
+			}
+		}
+	} else if isBlank(e.src[end:e.lineEnd(end)]) {
+		// The parameter is the last on the line, so remove the separator
+		// before it.
+		start = e.trimSpace(start)
+
+		if start > 0 && e.src[start-1] == ';' {
+			start = e.trimSpace(start - 1)
+		}
+	} else {
+		for end < len(e.src) && (e.src[end] == ' ' || e.src[end] == '\t') {
+			end++
+		}
+	}
+	return e.replace(start, end, nil)
+}
@@ -0,0 +1,398 @@
+package config
+
+import (
+	"testing"
+)
+
+func Test_Editor(t *testing.T) {
+	src := `# Server configuration.
+
+log debug "/dev/stdout"
+
+net {
+	listen "localhost:443"
+
+	tls {
+		cert "/var/lib/ssl/server.crt" # Rotated yearly.
+		key  "/var/lib/ssl/server.key"
+	}
+}
+
+# Deprecated, use tls instead.
+ssl {
+	ca "/var/lib/ssl/ca.crt"
+}
+
+auth ldap {
+	addr "ldap://example.com"
+}
+
+cache {}
+`
+
+	tests := []struct {
+		edit     func(e *Editor) error
+		expected string
+	}{
+		{
+			func(e *Editor) error {
+				return e.Set("net.tls.cert", "/etc/ssl/server.crt")
+			},
+			`# Server configuration.
+
+log debug "/dev/stdout"
+
+net {
+	listen "localhost:443"
+
+	tls {
+		cert "/etc/ssl/server.crt" # Rotated yearly.
+		key  "/var/lib/ssl/server.key"
+	}
+}
+
+# Deprecated, use tls instead.
+ssl {
+	ca "/var/lib/ssl/ca.crt"
+}
+
+auth ldap {
+	addr "ldap://example.com"
+}
+
+cache {}
+`,
+		},
+		{
+			func(e *Editor) error {
+				if err := e.Set("log.debug", "/var/log/debug.log"); err != nil {
+					return err
+				}
+				if err := e.Set("net.tls.ciphers", []string{"AES-128SHA256"}); err != nil {
+					return err
+				}
+				return e.Set("cache.ttl", struct{ Redis string }{"localhost:6379"})
+			},
+			`# Server configuration.
+
+log debug "/var/log/debug.log"
+
+net {
+	listen "localhost:443"
+
+	tls {
+		cert "/var/lib/ssl/server.crt" # Rotated yearly.
+		key  "/var/lib/ssl/server.key"
+		ciphers ["AES-128SHA256"]
+	}
+}
+
+# Deprecated, use tls instead.
+ssl {
+	ca "/var/lib/ssl/ca.crt"
+}
+
+auth ldap {
+	addr "ldap://example.com"
+}
+
+cache {
+	ttl {
+		redis "localhost:6379"
+	}
+}
+`,
+		},
+		{
+			func(e *Editor) error {
+				if err := e.Add("", "auth okta {\naddr \"https://okta.example.com\"\n}"); err != nil {
+					return err
+				}
+				return e.Add("auth.ldap", "tls {\n\tca \"/var/lib/ssl/ca.crt\"\n}")
+			},
+			`# Server configuration.
+
+log debug "/dev/stdout"
+
+net {
+	listen "localhost:443"
+
+	tls {
+		cert "/var/lib/ssl/server.crt" # Rotated yearly.
+		key  "/var/lib/ssl/server.key"
+	}
+}
+
+# Deprecated, use tls instead.
+ssl {
+	ca "/var/lib/ssl/ca.crt"
+}
+
+auth ldap {
+	addr "ldap://example.com"
+
+	tls {
+		ca "/var/lib/ssl/ca.crt"
+	}
+}
+
+cache {}
+
+auth okta {
+	addr "https://okta.example.com"
+}
+`,
+		},
+		{
+			func(e *Editor) error {
+				if err := e.Delete("ssl"); err != nil {
+					return err
+				}
+				return e.Delete("net.tls.cert")
+			},
+			`# Server configuration.
+
+log debug "/dev/stdout"
+
+net {
+	listen "localhost:443"
+
+	tls {
+		key  "/var/lib/ssl/server.key"
+	}
+}
+
+auth ldap {
+	addr "ldap://example.com"
+}
+
+cache {}
+`,
+		},
+	}
+
+	for i, test := range tests {
+		e, err := NewEditor("server.conf", []byte(src))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := test.edit(e); err != nil {
+			t.Errorf("tests[%d] - %s\n", i, err)
+			continue
+		}
+
+		if s := string(e.Bytes()); s != test.expected {
+			t.Errorf("tests[%d] - unexpected source\n\texpected =\n%s\n\tgot =\n%s\n", i, test.expected, s)
+		}
+	}
+}
+
+func Test_EditorBlocks(t *testing.T) {
+	src := `auth ldap { addr "y" }
+
+cache { }
+
+net {
+	listen "localhost:443"
+
+	tls {
+		cert "/var/lib/ssl/server.crt"
+	}
+}
+`
+
+	tests := []struct {
+		edit     func(e *Editor) error
+		expected string
+	}{
+		{
+			func(e *Editor) error {
+				return e.Set("auth.ldap.port", 389)
+			},
+			`auth ldap {
+	addr "y"
+	port 389
+}
+
+cache { }
+
+net {
+	listen "localhost:443"
+
+	tls {
+		cert "/var/lib/ssl/server.crt"
+	}
+}
+`,
+		},
+		{
+			func(e *Editor) error {
+				return e.Add("auth.ldap", "tls {\n\tca \"/var/lib/ssl/ca.crt\"\n}")
+			},
+			`auth ldap {
+	addr "y"
+
+	tls {
+		ca "/var/lib/ssl/ca.crt"
+	}
+}
+
+cache { }
+
+net {
+	listen "localhost:443"
+
+	tls {
+		cert "/var/lib/ssl/server.crt"
+	}
+}
+`,
+		},
+		{
+			func(e *Editor) error {
+				return e.Set("cache.ttl", "1h")
+			},
+			`auth ldap { addr "y" }
+
+cache {
+	ttl "1h"
+}
+
+net {
+	listen "localhost:443"
+
+	tls {
+		cert "/var/lib/ssl/server.crt"
+	}
+}
+`,
+		},
+		{
+			func(e *Editor) error {
+				return e.Delete("net.listen")
+			},
+			`auth ldap { addr "y" }
+
+cache { }
+
+net {
+	tls {
+		cert "/var/lib/ssl/server.crt"
+	}
+}
+`,
+		},
+	}
+
+	for i, test := range tests {
+		e, err := NewEditor("server.conf", []byte(src))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := test.edit(e); err != nil {
+			t.Errorf("tests[%d] - %s\n", i, err)
+			continue
+		}
+
+		if s := string(e.Bytes()); s != test.expected {
+			t.Errorf("tests[%d] - unexpected source\n\texpected =\n%s\n\tgot =\n%s\n", i, test.expected, s)
+		}
+	}
+}
+
+func Test_EditorLines(t *testing.T) {
+	tests := []struct {
+		src      string
+		edit     func(e *Editor) error
+		expected string
+	}{
+		{
+			"a 1; b 2\n",
+			func(e *Editor) error { return e.Delete("a") },
+			"b 2\n",
+		},
+		{
+			"a 1; b 2\n",
+			func(e *Editor) error { return e.Delete("b") },
+			"a 1\n",
+		},
+		{
+			"a 1; b 2",
+			func(e *Editor) error { return e.Delete("b") },
+			"a 1",
+		},
+		{
+			"x 0; a 1; b 2\n",
+			func(e *Editor) error { return e.Delete("a") },
+			"x 0; b 2\n",
+		},
+		{
+			"a 1;\nb 2\n",
+			func(e *Editor) error { return e.Delete("a") },
+			"b 2\n",
+		},
+		{
+			"a 1\n\nb 2\n",
+			func(e *Editor) error { return e.Delete("b") },
+			"a 1\n",
+		},
+		{
+			"a { c 1 }\n",
+			func(e *Editor) error { return e.Add("a", "d 2") },
+			"a {\n\tc 1\n\td 2\n}\n",
+		},
+		{
+			"a { c 1; d 2 }\n",
+			func(e *Editor) error { return e.Add("a", "e 3") },
+			"a {\n\tc 1\n\td 2\n\te 3\n}\n",
+		},
+		{
+			"a { c 1; d 2\n\te 3\n}\n",
+			func(e *Editor) error { return e.Add("a", "f 4") },
+			"a {\n\tc 1\n\td 2\n\te 3\n\tf 4\n}\n",
+		},
+	}
+
+	for i, test := range tests {
+		e, err := NewEditor("lines.conf", []byte(test.src))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := test.edit(e); err != nil {
+			t.Errorf("tests[%d] - %s\n", i, err)
+			continue
+		}
+
+		if s := string(e.Bytes()); s != test.expected {
+			t.Errorf("tests[%d] - unexpected source\n\texpected =\n%q\n\tgot =\n%q\n", i, test.expected, s)
+		}
+	}
+}
+
+func Test_EditorErrors(t *testing.T) {
+	e, err := NewEditor("server.conf", []byte("net {\n\tlisten \"localhost:443\"\n}\n"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []func() error{
+		func() error { return e.Set("", 10) },
+		func() error { return e.Set("cache.ttl", "1h") },
+		func() error { return e.Set("net.listen.addr", "localhost") },
+		func() error { return e.Add("net", "tls {") },
+		func() error { return e.Delete("net.tls") },
+	}
+
+	for i, test := range tests {
+		if err := test(); err == nil {
+			t.Errorf("tests[%d] - expected error, got nil\n", i)
+		}
+	}
+}
@@ -0,0 +1,487 @@
+package config
+
+import (
+	"bytes"
+	"encoding"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Encoder writes configuration to an output stream.
+type Encoder struct {
+	w io.Writer
+}
+
+// NewEncoder returns a new encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{
+		w: w,
+	}
+}
+
+// Marshal returns the configuration encoding of v. This is the same as
+// calling Encode on an Encoder.
+func Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+
+	if err := NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Encode writes the configuration encoding of v to the stream in canonical
+// form, as returned by Format. The given value
+// must either be a struct, or a pointer to a struct. Each field of the struct
+// is written as a parameter, following the same rules for the config struct
+// tag as the Decoder. Maps of fields are written as labelled parameters, and
+// fields with the nogroup option are written as labelled parameters for each
+// field of the underlying struct.
+func (e *Encoder) Encode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return errors.New("config: cannot encode nil pointer")
+		}
+		rv = rv.Elem()
+	}
+
+	if kind := rv.Kind(); kind != reflect.Struct {
+		return errors.New("config: cannot encode " + kind.String())
+	}
+
+	var enc encoder
+
+	if err := enc.params(rv); err != nil {
+		return err
+	}
+
+	// Format what was encoded so the values of parameters are aligned.
+	b, err := Format("", enc.buf.Bytes())
+
+	if err != nil {
+		return err
+	}
+
+	_, err = e.w.Write(b)
+	return err
+}
+
+type encoder struct {
+	buf   bytes.Buffer
+	depth int
+
+	// written denotes whether a parameter has been written at the current
+	// depth, and multiline whether that parameter spanned multiple lines.
+	written   bool
+	multiline bool
+}
+
+// indirect dereferences the given value until a value that is neither a
+// pointer nor an interface is found. If a nil value is found, then false is
+// returned.
+func indirect(rv reflect.Value) (reflect.Value, bool) {
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return rv, false
+		}
+		rv = rv.Elem()
+	}
+	return rv, true
+}
+
+func isIdent(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for i, r := range s {
+		if !isLetter(r) && (i == 0 || !isDigit(r)) {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedKeys(rv reflect.Value) ([]string, error) {
+	if kind := rv.Type().Key().Kind(); kind != reflect.String {
+		return nil, errors.New("config: cannot encode map with " + kind.String() + " key")
+	}
+
+	keys := make([]string, 0, rv.Len())
+
+	for _, k := range rv.MapKeys() {
+		keys = append(keys, k.String())
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (e *encoder) indent() {
+	for i := 0; i < e.depth; i++ {
+		e.buf.WriteByte('\t')
+	}
+}
+
+// params writes each field of the given struct as a parameter.
+func (e *encoder) params(rv reflect.Value) error {
+	fields := loadFields(rv)
+
+	for _, f := range fields.arr {
+		v, ok := indirect(f.val)
+
+		if !ok {
+			continue
+		}
+
+		if f.nogroup && v.Kind() == reflect.Struct {
+			for _, label := range loadFields(v).arr {
+				lv, ok := indirect(label.val)
+
+				if !ok {
+					continue
+				}
+
+				if err := e.param(f.param(), label.param(), lv); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if v.Kind() == reflect.Map {
+			keys, err := sortedKeys(v)
+
+			if err != nil {
+				return err
+			}
+
+			for _, key := range keys {
+				mv, ok := indirect(v.MapIndex(reflect.ValueOf(key).Convert(v.Type().Key())))
+
+				if !ok {
+					continue
+				}
+
+				if err := e.param(f.param(), key, mv); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			continue
+		}
+
+		if err := e.param(f.param(), "", v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// param writes a single parameter with the given name, and optional label. A
+// blank line is written before, and after any parameter that spans multiple
+// lines.
+func (e *encoder) param(name, label string, rv reflect.Value) error {
+	if !isIdent(label) && label != "" {
+		return fmt.Errorf("config: cannot encode %q as label for %s", label, name)
+	}
+
+	// Write the value with a separate encoder first so we know whether the
+	// parameter spans multiple lines.
+	val := &encoder{
+		depth: e.depth,
+	}
+
+	if err := val.value(rv); err != nil {
+		return err
+	}
+
+	multiline := bytes.IndexByte(val.buf.Bytes(), '\n') >= 0
+
+	if e.written && (multiline || e.multiline) {
+		e.buf.WriteByte('\n')
+	}
+
+	e.indent()
+	e.buf.WriteString(name)
+
+	if label != "" {
+		e.buf.WriteByte(' ')
+		e.buf.WriteString(label)
+	}
+
+	e.buf.WriteByte(' ')
+	e.buf.Write(val.buf.Bytes())
+	e.buf.WriteByte('\n')
+
+	e.written = true
+	e.multiline = multiline
+	return nil
+}
+
+// encodeParam returns the configuration encoding of a single parameter in
+// canonical form.
+func encodeParam(name, label string, rv reflect.Value) ([]byte, error) {
+	var e encoder
+
+	if err := e.param(name, label, rv); err != nil {
+		return nil, err
+	}
+	return Format("", e.buf.Bytes())
+}
+
+// formatDuration returns the duration literal for d. Durations are written in
+// hours, minutes, and seconds, and anything less than a second is written in
+// the largest unit that represents it exactly.
+func formatDuration(d time.Duration) string {
+	if d == 0 {
+		return "0s"
+	}
+
+	var buf strings.Builder
+
+	if d < 0 {
+		buf.WriteByte('-')
+		d = -d
+	}
+
+	if h := d / time.Hour; h > 0 {
+		buf.WriteString(strconv.FormatInt(int64(h), 10) + "h")
+		d -= h * time.Hour
+	}
+
+	if m := d / time.Minute; m > 0 {
+		buf.WriteString(strconv.FormatInt(int64(m), 10) + "m")
+		d -= m * time.Minute
+	}
+
+	switch {
+	case d == 0:
+	case d >= time.Second:
+		buf.WriteString(strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s")
+	case d%time.Millisecond == 0:
+		buf.WriteString(strconv.FormatInt(int64(d/time.Millisecond), 10) + "ms")
+	case d%time.Microsecond == 0:
+		buf.WriteString(strconv.FormatInt(int64(d/time.Microsecond), 10) + "us")
+	default:
+		buf.WriteString(strconv.FormatInt(int64(d), 10) + "ns")
+	}
+	return buf.String()
+}
+
+// quote returns s as a quoted string literal. Special characters are escaped,
+// and any ${ is written as $${ so it is not expanded when decoded.
+func quote(s string) string {
+	return strings.ReplaceAll(strconv.Quote(s), "${", "$${")
+}
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// textMarshaler returns the given value as an encoding.TextMarshaler if it, or
+// a pointer to it, implements the interface.
+func textMarshaler(rv reflect.Value) (encoding.TextMarshaler, bool) {
+	rt := rv.Type()
+
+	if rt.Implements(textMarshalerType) {
+		return rv.Interface().(encoding.TextMarshaler), true
+	}
+
+	if !reflect.PtrTo(rt).Implements(textMarshalerType) {
+		return nil, false
+	}
+
+	if rv.CanAddr() {
+		return rv.Addr().Interface().(encoding.TextMarshaler), true
+	}
+
+	pv := reflect.New(rt)
+	pv.Elem().Set(rv)
+
+	return pv.Interface().(encoding.TextMarshaler), true
+}
+
+func (e *encoder) value(rv reflect.Value) error {
+	if !rv.IsValid() {
+		return errors.New("config: cannot encode nil")
+	}
+
+	rv, ok := indirect(rv)
+
+	if !ok {
+		return errors.New("config: cannot encode nil " + rv.Type().String())
+	}
+
+	switch rv.Type() {
+	case durationType, configDurationType:
+		e.buf.WriteString(formatDuration(time.Duration(rv.Int())))
+		return nil
+	case sizeType:
+		e.buf.WriteString(Size(rv.Int()).String())
+		return nil
+	}
+
+	if m, ok := textMarshaler(rv); ok {
+		text, err := m.MarshalText()
+
+		if err != nil {
+			return errors.New("config: " + err.Error())
+		}
+
+		e.buf.WriteString(quote(string(text)))
+		return nil
+	}
+
+	switch rv.Kind() {
+	case reflect.String:
+		e.buf.WriteString(quote(rv.String()))
+	case reflect.Bool:
+		e.buf.WriteString(strconv.FormatBool(rv.Bool()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.buf.WriteString(strconv.FormatInt(rv.Int(), 10))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		e.buf.WriteString(strconv.FormatUint(rv.Uint(), 10))
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return errors.New("config: cannot encode float " + strconv.FormatFloat(f, 'g', -1, 64))
+		}
+
+		s := strconv.FormatFloat(f, 'f', -1, rv.Type().Bits())
+
+		// Make sure the literal is still scanned as a float.
+		if !strings.Contains(s, ".") {
+			s += ".0"
+		}
+		e.buf.WriteString(s)
+	case reflect.Struct:
+		return e.block(func() error {
+			return e.params(rv)
+		})
+	case reflect.Map:
+		keys, err := sortedKeys(rv)
+
+		if err != nil {
+			return err
+		}
+
+		return e.block(func() error {
+			for _, key := range keys {
+				if !isIdent(key) {
+					return fmt.Errorf("config: cannot encode %q as parameter name", key)
+				}
+
+				mv, ok := indirect(rv.MapIndex(reflect.ValueOf(key).Convert(rv.Type().Key())))
+
+				if !ok {
+					continue
+				}
+
+				if err := e.param(key, "", mv); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	case reflect.Slice, reflect.Array:
+		return e.array(rv)
+	default:
+		return errors.New("config: cannot encode " + rv.Type().String())
+	}
+	return nil
+}
+
+// block writes a block, calling fn to write the parameters within the block.
+// If no parameters are written, then an empty block is written.
+func (e *encoder) block(fn func() error) error {
+	e.buf.WriteByte('{')
+
+	depth, written, multiline := e.depth, e.written, e.multiline
+	n := e.buf.Len()
+
+	e.depth++
+	e.written = false
+	e.multiline = false
+	e.buf.WriteByte('\n')
+
+	if err := fn(); err != nil {
+		return err
+	}
+
+	e.depth, e.written, e.multiline = depth, written, multiline
+
+	if e.buf.Len() == n+1 {
+		e.buf.Truncate(n)
+		e.buf.WriteByte('}')
+		return nil
+	}
+
+	e.indent()
+	e.buf.WriteByte('}')
+	return nil
+}
+
+// array writes the given slice or array. Arrays of blocks are written with
+// each block following the other, arrays of arrays are written with one item
+// per line, and all other arrays are written on a single line.
+func (e *encoder) array(rv reflect.Value) error {
+	e.buf.WriteByte('[')
+
+	if rv.Len() == 0 {
+		e.buf.WriteByte(']')
+		return nil
+	}
+
+	el := rv.Type().Elem()
+
+	for el.Kind() == reflect.Ptr {
+		el = el.Elem()
+	}
+
+	if kind := el.Kind(); kind == reflect.Slice || kind == reflect.Array {
+		e.depth++
+
+		for i := 0; i < rv.Len(); i++ {
+			e.buf.WriteByte('\n')
+			e.indent()
+
+			if err := e.value(rv.Index(i)); err != nil {
+				return err
+			}
+			e.buf.WriteByte(',')
+		}
+
+		e.depth--
+		e.buf.WriteByte('\n')
+		e.indent()
+		e.buf.WriteByte(']')
+		return nil
+	}
+
+	for i := 0; i < rv.Len(); i++ {
+		if i > 0 {
+			e.buf.WriteString(", ")
+		}
+
+		if err := e.value(rv.Index(i)); err != nil {
+			return err
+		}
+	}
+
+	e.buf.WriteByte(']')
+	return nil
+}
@@ -0,0 +1,184 @@
+package config
+
+import (
+	"bytes"
+	"log/slog"
+	"math/big"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_Encode(t *testing.T) {
+	type TLS struct {
+		Cert string
+		Key  string
+	}
+
+	type Store struct {
+		Type  string
+		Path  string
+		Limit int64
+	}
+
+	cfg := struct {
+		Log map[string]string
+
+		Net struct {
+			Listen string
+
+			TLS TLS
+		}
+
+		Drivers []string
+
+		Cache struct {
+			CleanupInterval time.Duration `config:"cleanup_interval"`
+		}
+
+		Store map[string]Store
+
+		Secret string `config:"-"`
+	}{
+		Log:     map[string]string{"debug": "/dev/stdout"},
+		Drivers: []string{"docker", "qemu-x86_64"},
+		Store: map[string]Store{
+			"files": {Type: "file", Path: "/var/lib/files", Limit: 50},
+		},
+		Secret: "secret",
+	}
+
+	cfg.Net.Listen = "localhost:443"
+	cfg.Net.TLS = TLS{Cert: "/var/lib/ssl/server.crt", Key: "/var/lib/ssl/server.key"}
+	cfg.Cache.CleanupInterval = time.Hour + time.Minute*30
+
+	b, err := Marshal(cfg)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `log debug "/dev/stdout"
+
+net {
+	listen "localhost:443"
+
+	tls {
+		cert "/var/lib/ssl/server.crt"
+		key  "/var/lib/ssl/server.key"
+	}
+}
+
+drivers ["docker", "qemu-x86_64"]
+
+cache {
+	cleanup_interval 1h30m
+}
+
+store files {
+	type  "file"
+	path  "/var/lib/files"
+	limit 50
+}
+`
+
+	if string(b) != expected {
+		t.Fatalf("unexpected encoding\n\texpected =\n%s\n\tgot =\n%s\n", expected, string(b))
+	}
+}
+
+func Test_EncodeRoundTrip(t *testing.T) {
+	type Block struct {
+		String string
+	}
+
+	type Config struct {
+		Strings   []string
+		Ints      []int64
+		Floats    []float64
+		Bools     []bool
+		Durations []time.Duration
+		Sizes     []Size
+		Timeout   Duration
+		Addr      netip.Addr
+		Level     slog.Level
+		When      time.Time
+		Total     *big.Int
+		Blocks    []Block
+		Arrays    [][]int64
+		Empty     struct{}
+		Labels    map[string]map[string][]string
+
+		Driver struct {
+			Docker struct {
+				Host string
+			}
+
+			QEMU struct {
+				CPUs int64
+			}
+		} `config:",nogroup"`
+	}
+
+	cfg := Config{
+		Strings:   []string{"one", `"two"`, "细绳", "line\nline", `C:\dir`, "${HOME}", "$${HOME}", "\t\x00"},
+		Ints:      []int64{1, -2, 3},
+		Floats:    []float64{1, 2.5},
+		Bools:     []bool{true, false},
+		Durations: []time.Duration{time.Second, time.Minute * 2, time.Hour*3 + time.Second/2, 500 * time.Millisecond, 250 * time.Microsecond, 5},
+		Sizes:     []Size{50 * Megabyte, 50 * Mebibyte, 1500},
+		Timeout:   Duration(36 * time.Hour),
+		Addr:      netip.MustParseAddr("192.168.1.10"),
+		Level:     slog.LevelWarn,
+		When:      time.Date(2024, time.March, 1, 12, 30, 0, 0, time.UTC),
+		Total:     big.NewInt(1 << 62),
+		Blocks:    []Block{{"foo"}, {"bar"}},
+		Arrays:    [][]int64{{1, 2}, {3, 4}},
+		Labels: map[string]map[string][]string{
+			"qemu": {
+				"arch": {"x86_64", "aarch64"},
+			},
+		},
+	}
+
+	cfg.Driver.Docker.Host = "unix:///var/run/docker.sock"
+	cfg.Driver.QEMU.CPUs = 2
+
+	b, err := Marshal(&cfg)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded Config
+
+	if err := NewDecoder("encoded", ErrorHandler(errh(t))).Decode(&decoded, bytes.NewReader(b)); err != nil {
+		t.Fatalf("%s\n%s\n", err, string(b))
+	}
+
+	if decoded.Total == nil || decoded.Total.Cmp(cfg.Total) != 0 {
+		t.Fatalf("unexpected Total, expected=%s, got=%s\n", cfg.Total, decoded.Total)
+	}
+
+	cfg.Total, decoded.Total = nil, nil
+
+	if !reflect.DeepEqual(cfg, decoded) {
+		t.Fatalf("decoded configuration does not match\n\texpected =%v\n\tgot = %v\n", cfg, decoded)
+	}
+}
+
+func Test_EncodeErrors(t *testing.T) {
+	tests := []interface{}{
+		10,
+		struct{ Map map[int]string }{Map: map[int]string{1: "one"}},
+		struct{ Map map[string]string }{Map: map[string]string{"not a label": "one"}},
+		struct{ Chan chan int }{Chan: make(chan int)},
+	}
+
+	for i, test := range tests {
+		if _, err := Marshal(test); err == nil {
+			t.Errorf("tests[%d] - expected error, got nil\n", i)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Error is an error that occurred at a position in a source. Err is the
+// underlying error, if any, such as the error returned from a Validator.
+type Error struct {
+	Pos Pos
+	Msg string
+	Err error
+}
+
+func (e *Error) Error() string {
+	if pos := e.Pos.String(); pos != "" {
+		return pos + " - " + e.Msg
+	}
+	return e.Msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ErrorList is a list of errors that occurred in a source. The zero value is
+// an empty list ready to use.
+type ErrorList []*Error
+
+// Add adds an error with the given position and message to the list.
+func (l *ErrorList) Add(pos Pos, msg string) {
+	*l = append(*l, &Error{Pos: pos, Msg: msg})
+}
+
+func (l ErrorList) Len() int      { return len(l) }
+func (l ErrorList) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+
+func (l ErrorList) Less(i, j int) bool {
+	e, f := l[i].Pos, l[j].Pos
+
+	if e.File != f.File {
+		return e.File < f.File
+	}
+	if e.Line != f.Line {
+		return e.Line < f.Line
+	}
+	if e.Col != f.Col {
+		return e.Col < f.Col
+	}
+	return l[i].Msg < l[j].Msg
+}
+
+// Sort sorts the list by file, line, column, and then message.
+func (l ErrorList) Sort() {
+	sort.Sort(l)
+}
+
+// RemoveMultiples sorts the list, and removes all but the first error on each
+// line.
+func (l *ErrorList) RemoveMultiples() {
+	sort.Sort(l)
+
+	var last Pos
+
+	i := 0
+
+	for _, e := range *l {
+		if e.Pos.File != last.File || e.Pos.Line != last.Line {
+			last = e.Pos
+			(*l)[i] = e
+			i++
+		}
+	}
+	*l = (*l)[:i]
+}
+
+// Error returns the first error in the list, along with the number of other
+// errors.
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
+}
+
+// Err returns an error for the list. If the list is empty then nil is
+// returned.
+func (l ErrorList) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	return l
+}
+
+// Unwrap returns each error in the list, so errors.Is and errors.As can be
+// used on the list.
+func (l ErrorList) Unwrap() []error {
+	errs := make([]error, 0, len(l))
+
+	for _, e := range l {
+		errs = append(errs, e)
+	}
+	return errs
+}
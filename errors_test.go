@@ -0,0 +1,89 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func Test_ErrorList(t *testing.T) {
+	var errs ErrorList
+
+	if err := errs.Err(); err != nil {
+		t.Fatalf("unexpected error, expected=nil, got=%q\n", err)
+	}
+
+	errs.Add(Pos{File: "b.conf", Line: 1, Col: 1}, "third")
+	errs.Add(Pos{File: "a.conf", Line: 2, Col: 5}, "second")
+	errs.Add(Pos{File: "a.conf", Line: 2, Col: 1}, "first")
+	errs.Add(Pos{File: "a.conf", Line: 1, Col: 9}, "zeroth")
+
+	errs.Sort()
+
+	expected := []string{"zeroth", "first", "second", "third"}
+
+	for i, e := range errs {
+		if e.Msg != expected[i] {
+			t.Errorf("errs[%d] - unexpected message, expected=%q, got=%q\n", i, expected[i], e.Msg)
+		}
+	}
+
+	if expected := "a.conf,1:9 - zeroth (and 3 more errors)"; errs.Error() != expected {
+		t.Errorf("unexpected error, expected=%q, got=%q\n", expected, errs.Error())
+	}
+
+	errs.RemoveMultiples()
+
+	if l := len(errs); l != 3 {
+		t.Fatalf("unexpected number of errors, expected=%d, got=%d\n", 3, l)
+	}
+
+	var e *Error
+
+	if !errors.As(errs.Err(), &e) {
+		t.Fatalf("expected errors.As to find %T\n", e)
+	}
+
+	if e.Msg != "zeroth" {
+		t.Fatalf("unexpected message, expected=%q, got=%q\n", "zeroth", e.Msg)
+	}
+}
+
+func Test_ParseErrorList(t *testing.T) {
+	src := `a 1.2.3
+b "\q"
+c 10x; d 20y
+`
+
+	_, err := Parse("errors.conf", strings.NewReader(src))
+
+	errs, ok := err.(ErrorList)
+
+	if !ok {
+		t.Fatalf("unexpected error type, expected=%T, got=%T\n", errs, err)
+	}
+
+	expected := []string{
+		"errors.conf,1:3 - malformed number 1.2.3",
+		"errors.conf,2:4 - unknown escape sequence",
+		"errors.conf,3:3 - malformed number 10x",
+	}
+
+	if l := len(errs); l != len(expected) {
+		t.Fatalf("unexpected number of errors, expected=%d, got=%d\n%s\n", len(expected), l, errs)
+	}
+
+	for i, e := range errs {
+		if e.Error() != expected[i] {
+			t.Errorf("errs[%d] - unexpected error, expected=%q, got=%q\n", i, expected[i], e.Error())
+		}
+	}
+
+	var cfg struct {
+		A float64
+	}
+
+	if err := NewDecoder("errors.conf").Decode(&cfg, strings.NewReader(src)); !errors.As(err, &errs) || len(errs) != len(expected) {
+		t.Fatalf("unexpected error, expected %d errors, got=%v\n", len(expected), err)
+	}
+}
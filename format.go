@@ -0,0 +1,391 @@
+package config
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+)
+
+// Format returns the canonical formatting of the given configuration source.
+// Parameters are indented with tabs, the values of consecutive parameters
+// within a block are aligned, and comments are kept. The name is used to
+// identify the source in any errors that are returned.
+func Format(name string, src []byte) ([]byte, error) {
+	f, err := Parse(name, bytes.NewReader(src))
+
+	if err != nil {
+		return nil, err
+	}
+
+	p := printer{
+		comments: make([]*Comment, 0, len(f.Comments)),
+		first:    true,
+	}
+
+	for _, g := range f.Comments {
+		p.comments = append(p.comments, g.List...)
+	}
+
+	p.params(f.Params, Pos{Line: -1})
+
+	return p.buf.Bytes(), nil
+}
+
+// printer prints the parameters of a parsed source in canonical form. The
+// comments of the source are interleaved with the parameters based on their
+// positions.
+type printer struct {
+	buf   bytes.Buffer
+	depth int
+
+	comments []*Comment
+
+	// last is the source line of the last node printed, and first denotes
+	// whether nothing has been printed in the current block.
+	last  int
+	first bool
+}
+
+func (p *printer) indent() {
+	for i := 0; i < p.depth; i++ {
+		p.buf.WriteByte('\t')
+	}
+}
+
+// hasComments reports whether there are any comments between the two given
+// positions.
+func (p *printer) hasComments(start, end Pos) bool {
+	for _, c := range p.comments {
+		if c.pos.Line > start.Line || c.pos.Line == start.Line && c.pos.Col > start.Col {
+			return c.pos.Line < end.Line || c.pos.Line == end.Line && c.pos.Col < end.Col
+		}
+	}
+	return false
+}
+
+// blank reports whether there is a blank line between the two given lines.
+func (p *printer) blank(start, end int) bool {
+	lines := make(map[int]struct{})
+
+	for _, c := range p.comments {
+		if c.pos.Line > start && c.pos.Line < end {
+			lines[c.pos.Line] = struct{}{}
+		}
+	}
+	return end-start-1 > len(lines)
+}
+
+// newline writes a blank line if there is one in the source between the last
+// printed node and the given line.
+func (p *printer) newline(line int) {
+	if !p.first && line-p.last > 1 {
+		p.buf.WriteByte('\n')
+	}
+}
+
+// flush writes all of the comments before the given line. If the line is < 0
+// then all remaining comments are written.
+func (p *printer) flush(line int) {
+	for len(p.comments) > 0 {
+		c := p.comments[0]
+
+		if line >= 0 && c.pos.Line >= line {
+			break
+		}
+
+		p.newline(c.pos.Line)
+		p.indent()
+		p.buf.WriteString(c.Text)
+		p.buf.WriteByte('\n')
+
+		p.comments = p.comments[1:]
+		p.last = c.pos.Line
+		p.first = false
+	}
+}
+
+// trailing writes the comment on the last printed line, if any. Only a comment
+// before the given position is written, so a comment after the next node on
+// the same line is left for that node. If the line of the position is < 0 then
+// the comment can be anywhere on the line.
+func (p *printer) trailing(end Pos) {
+	if len(p.comments) == 0 {
+		return
+	}
+
+	c := p.comments[0]
+
+	if end.Line >= 0 && (c.pos.Line > end.Line || c.pos.Line == end.Line && c.pos.Col > end.Col) {
+		return
+	}
+
+	if c.pos.Line == p.last {
+		p.buf.WriteByte(' ')
+		p.buf.WriteString(c.Text)
+		p.comments = p.comments[1:]
+	}
+}
+
+// multiline reports whether the given node would be printed across multiple
+// lines.
+func (p *printer) multiline(n Node) bool {
+	switch v := n.(type) {
+	case *Lit:
+		return v.End().Line != v.Pos().Line
+	case *Block:
+		return len(v.Params) > 0 || p.hasComments(v.Pos(), v.Rbrace)
+	case *Array:
+		if v.Pos().Line != v.Rbrack.Line {
+			return true
+		}
+
+		for _, it := range v.Items {
+			if p.multiline(it) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// endLine returns the source line on which the given parameter ends.
+func endLine(n *Param) int {
+	switch v := n.Value.(type) {
+	case *Lit:
+		return v.End().Line
+	case *Block:
+		return v.Rbrace.Line
+	case *Array:
+		return v.Rbrack.Line
+	}
+
+	if n.Label != nil {
+		return n.Label.Pos().Line
+	}
+	return n.Name.Pos().Line
+}
+
+func paramKey(n *Param) string {
+	if n.Label != nil {
+		return n.Name.Value + " " + n.Label.Value
+	}
+	return n.Name.Value
+}
+
+// params prints the given parameters followed by any comments before the end
+// position. Consecutive single line parameters that are not separated by a
+// blank line have their values aligned.
+func (p *printer) params(params []*Param, end Pos) {
+	widths := make([]int, len(params))
+
+	for i := 0; i < len(params); {
+		j := i
+		width := 0
+
+		for ; j < len(params); j++ {
+			n := params[j]
+
+			if j > i && p.blank(endLine(params[j-1]), n.Pos().Line) {
+				break
+			}
+
+			if p.multiline(n.Value) {
+				if j == i {
+					j++
+				}
+				break
+			}
+
+			if w := utf8.RuneCountInString(paramKey(n)); w > width {
+				width = w
+			}
+		}
+
+		for k := i; k < j; k++ {
+			widths[k] = width
+		}
+		i = j
+	}
+
+	for i, n := range params {
+		p.flush(n.Pos().Line)
+		p.newline(n.Pos().Line)
+
+		key := paramKey(n)
+
+		p.indent()
+		p.buf.WriteString(key)
+
+		p.last = n.Pos().Line
+		p.first = false
+
+		if n.Value != nil {
+			if !p.multiline(n.Value) {
+				p.buf.WriteString(strings.Repeat(" ", widths[i]-utf8.RuneCountInString(key)))
+			}
+
+			p.buf.WriteByte(' ')
+			p.node(n.Value)
+		}
+
+		next := Pos{Line: -1}
+
+		if i+1 < len(params) {
+			next = params[i+1].Pos()
+		}
+
+		p.last = endLine(n)
+		p.trailing(next)
+		p.buf.WriteByte('\n')
+	}
+	p.flush(end.Line)
+}
+
+func (p *printer) node(n Node) {
+	switch v := n.(type) {
+	case *Lit:
+		if v.Raw != "" {
+			p.buf.WriteString(v.Raw)
+			break
+		}
+
+		if v.Type == StringLit {
+			p.buf.WriteString(`"` + v.Value + `"`)
+			break
+		}
+		p.buf.WriteString(v.Value)
+	case *Block:
+		p.block(v)
+	case *Array:
+		p.array(v)
+	}
+}
+
+func (p *printer) block(n *Block) {
+	if !p.multiline(n) {
+		p.buf.WriteString("{}")
+		return
+	}
+
+	first := n.Rbrace
+
+	if len(n.Params) > 0 {
+		first = n.Params[0].Pos()
+	}
+
+	p.buf.WriteByte('{')
+	p.last = n.Pos().Line
+	p.trailing(first)
+	p.buf.WriteByte('\n')
+
+	p.depth++
+	p.first = true
+
+	p.params(n.Params, n.Rbrace)
+
+	p.depth--
+	p.indent()
+	p.buf.WriteByte('}')
+	p.last = n.Rbrace.Line
+}
+
+func (p *printer) array(n *Array) {
+	if !p.multiline(n) {
+		p.buf.WriteByte('[')
+
+		for i, it := range n.Items {
+			if i > 0 {
+				p.buf.WriteString(", ")
+			}
+			p.node(it)
+		}
+		p.buf.WriteByte(']')
+		return
+	}
+
+	// Arrays of blocks are printed with each block following the other, so
+	// long as there are no comments between the blocks themselves.
+	blocks := len(n.Items) > 0
+
+	for i, it := range n.Items {
+		b, ok := it.(*Block)
+
+		if !ok {
+			blocks = false
+			break
+		}
+
+		start := n.Pos()
+
+		if i > 0 {
+			start = n.Items[i-1].(*Block).Rbrace
+		}
+
+		if p.hasComments(start, b.Pos()) {
+			blocks = false
+			break
+		}
+	}
+
+	if blocks && !p.hasComments(n.Items[len(n.Items)-1].(*Block).Rbrace, n.Rbrack) {
+		p.buf.WriteByte('[')
+
+		for i, it := range n.Items {
+			if i > 0 {
+				p.buf.WriteString(", ")
+			}
+			p.block(it.(*Block))
+		}
+		p.buf.WriteByte(']')
+		p.last = n.Rbrack.Line
+		return
+	}
+
+	first := n.Rbrack
+
+	if len(n.Items) > 0 {
+		first = n.Items[0].Pos()
+	}
+
+	p.buf.WriteByte('[')
+	p.last = n.Pos().Line
+	p.trailing(first)
+	p.buf.WriteByte('\n')
+
+	p.depth++
+	p.first = true
+
+	for i, it := range n.Items {
+		p.flush(it.Pos().Line)
+		p.newline(it.Pos().Line)
+		p.indent()
+		p.node(it)
+		p.buf.WriteByte(',')
+
+		switch v := it.(type) {
+		case *Block:
+			p.last = v.Rbrace.Line
+		case *Array:
+			p.last = v.Rbrack.Line
+		default:
+			p.last = it.End().Line
+		}
+
+		next := Pos{Line: -1}
+
+		if i+1 < len(n.Items) {
+			next = n.Items[i+1].Pos()
+		}
+
+		p.first = false
+		p.trailing(next)
+		p.buf.WriteByte('\n')
+	}
+
+	p.flush(n.Rbrack.Line)
+
+	p.depth--
+	p.indent()
+	p.buf.WriteByte(']')
+	p.last = n.Rbrack.Line
+}
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_Format(t *testing.T) {
+	src, err := os.ReadFile(filepath.Join("testdata", "format.conf"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected, err := os.ReadFile(filepath.Join("testdata", "format.golden"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := Format("format.conf", src)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != string(expected) {
+		t.Fatalf("unexpected formatting\n\texpected =\n%s\n\tgot =\n%s\n", string(expected), string(b))
+	}
+
+	// Formatting should be idempotent.
+	b, err = Format("format.golden", expected)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != string(expected) {
+		t.Fatalf("formatting is not idempotent\n\texpected =\n%s\n\tgot =\n%s\n", string(expected), string(b))
+	}
+}
+
+func Test_FormatError(t *testing.T) {
+	if _, err := Format("error.conf", []byte("block {\n\tparam 10,\n}\n")); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
+
+func Test_FormatComments(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{
+			"a [1, # one\n2]\n",
+			"a [\n\t1, # one\n\t2,\n]\n",
+		},
+		{
+			"a [ # open\n1, # one\n2]\n",
+			"a [ # open\n\t1, # one\n\t2,\n]\n",
+		},
+		{
+			"b { x 1 # one\ny 2 }\n",
+			"b {\n\tx 1 # one\n\ty 2\n}\n",
+		},
+		{
+			"b { x 1; y 2 # two\n}\n",
+			"b {\n\tx 1\n\ty 2 # two\n}\n",
+		},
+	}
+
+	for _, test := range tests {
+		b, err := Format("comments.conf", []byte(test.src))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(b) != test.expected {
+			t.Errorf("%q: unexpected formatting\n\texpected =\n%s\n\tgot =\n%s\n", test.src, test.expected, string(b))
+		}
+	}
+}
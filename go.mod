@@ -1 +1,3 @@
 module github.com/andrewpillar/config
+
+go 1.21
@@ -1,7 +1,12 @@
 package config
 
-type node interface {
+import "strings"
+
+// Node is a node in the parse tree of a configuration file. Each node records
+// the position at which it starts and ends in the source.
+type Node interface {
 	Pos() Pos
+	End() Pos
 
 	Err(msg string) error
 }
@@ -10,43 +15,193 @@ type baseNode struct {
 	pos Pos
 }
 
+// Pos returns the position of the first character of the node.
 func (n baseNode) Pos() Pos {
 	return n.pos
 }
 
+// Err returns an error with the given message, prefixed with the position of
+// the node.
 func (n baseNode) Err(msg string) error {
 	return n.pos.Err(msg)
 }
 
-type name struct {
+// offset returns the given position moved along the line by n bytes.
+func offset(pos Pos, n int) Pos {
+	pos.Col += n
+	pos.Offset += n
+	return pos
+}
+
+// File is the parse tree of an entire configuration file. The position of the
+// file is the position of the first token in the file. Comments contains all
+// of the comments in the file, including those attached to parameters.
+type File struct {
+	baseNode
+
+	Name     string
+	Params   []*Param
+	Comments []*CommentGroup
+
+	eof Pos
+}
+
+// End returns the position of the end of the file.
+func (n *File) End() Pos {
+	return n.eof
+}
+
+// Name is the name of a parameter, or the label of a parameter.
+type Name struct {
 	baseNode
 
 	Value string
 }
 
-type lit struct {
+// End returns the position immediately after the name.
+func (n *Name) End() Pos {
+	return offset(n.pos, len(n.Value))
+}
+
+// Lit is a literal value, the Type denotes the type of literal. For string
+// literals the Value is the string itself, without the surrounding quotes or
+// delimiters. Raw is the literal as it appears in the source.
+type Lit struct {
 	baseNode
 
 	Value string
+	Raw   string
 	Type  LitType
 }
 
-type param struct {
+// End returns the position immediately after the literal.
+func (n *Lit) End() Pos {
+	if n.Raw == "" {
+		if n.Type == StringLit {
+			return offset(n.pos, len(n.Value)+2)
+		}
+		return offset(n.pos, len(n.Value))
+	}
+
+	i := strings.LastIndexByte(n.Raw, '\n')
+
+	if i < 0 {
+		return offset(n.pos, len(n.Raw))
+	}
+
+	// The literal spans multiple lines, so the end is on the last of them.
+	pos := n.pos
+	pos.Line += strings.Count(n.Raw, "\n")
+	pos.Col = len(n.Raw) - i
+	pos.Offset += len(n.Raw)
+
+	return pos
+}
+
+// Param is a parameter with an optional label. The Value will either be a
+// Lit, Block, or Array. If the parameter has a label but no value, then the
+// Value will be nil. Doc is the group of comments on the lines directly above
+// the parameter, and Comment is the comment following the parameter on the
+// same line, either may be nil.
+type Param struct {
 	baseNode
 
-	Name  *name
-	Label *name
-	Value node
+	Doc     *CommentGroup
+	Name    *Name
+	Label   *Name
+	Value   Node
+	Comment *CommentGroup
+}
+
+// End returns the position immediately after the value of the parameter.
+func (n *Param) End() Pos {
+	if n.Value != nil {
+		return n.Value.End()
+	}
+	if n.Label != nil {
+		return n.Label.End()
+	}
+	return n.Name.End()
 }
 
-type block struct {
+// Comment is a single comment. The Text of the comment includes the leading
+// #.
+type Comment struct {
 	baseNode
 
-	Params []*param
+	Text string
+}
+
+// End returns the position immediately after the comment.
+func (n *Comment) End() Pos {
+	return offset(n.pos, len(n.Text))
 }
 
-type array struct {
+// CommentGroup is a sequence of comments with no other tokens, and no blank
+// lines between them.
+type CommentGroup struct {
+	List []*Comment
+
+	line bool // whether the comment follows a token on the same line
+}
+
+// Pos returns the position of the first comment in the group.
+func (g *CommentGroup) Pos() Pos {
+	return g.List[0].Pos()
+}
+
+// End returns the position immediately after the last comment in the group.
+func (g *CommentGroup) End() Pos {
+	return g.List[len(g.List)-1].End()
+}
+
+// Err returns an error with the given message, prefixed with the position of
+// the group.
+func (g *CommentGroup) Err(msg string) error {
+	return g.Pos().Err(msg)
+}
+
+// Text returns the text of the comments in the group. The leading # of each
+// comment, and a single space following it are removed. Each comment is
+// separated by a newline.
+func (g *CommentGroup) Text() string {
+	lines := make([]string, 0, len(g.List))
+
+	for _, c := range g.List {
+		text := strings.TrimPrefix(c.Text, "#")
+		text = strings.TrimPrefix(text, " ")
+
+		lines = append(lines, text)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Block is a list of parameters wrapped in a pair of { }. The position of the
+// block is the position of the opening brace, and the position of the closing
+// brace is recorded in Rbrace.
+type Block struct {
+	baseNode
+
+	Params []*Param
+	Rbrace Pos
+}
+
+// End returns the position immediately after the closing brace.
+func (n *Block) End() Pos {
+	return offset(n.Rbrace, 1)
+}
+
+// Array is a list of values wrapped in a pair of [ ]. The position of the
+// array is the position of the opening bracket, and the position of the
+// closing bracket is recorded in Rbrack.
+type Array struct {
 	baseNode
 
-	Items []node
+	Items  []Node
+	Rbrack Pos
+}
+
+// End returns the position immediately after the closing bracket.
+func (n *Array) End() Pos {
+	return offset(n.Rbrack, 1)
 }
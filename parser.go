@@ -1,23 +1,18 @@
 package config
 
 import (
-	"fmt"
+	"io"
 	"os"
+	"strings"
 )
 
 type parser struct {
 	*scanner
 
-	errc     int
 	includes bool
 	inctab   map[string]string
 }
 
-func (p *parser) errAt(pos Pos, msg string) {
-	p.errc++
-	p.scanner.source.errh(pos, msg)
-}
-
 func (p *parser) err(msg string) {
 	p.errAt(p.pos, msg)
 }
@@ -60,21 +55,24 @@ func (p *parser) advance(follow ...token) {
 	}
 }
 
-func (p *parser) literal() *lit {
+func (p *parser) literal() *Lit {
 	if p.tok != _Literal {
 		return nil
 	}
 
-	n := &lit{
+	n := &Lit{
 		baseNode: p.node(),
 		Type:     p.typ,
 		Value:    p.lit,
+		Raw:      p.raw,
 	}
 	p.next()
 	return n
 }
 
-func (p *parser) list(sep, end token, parse func()) {
+// list parses a list of items separated by sep and terminated by end. The
+// position of the end token is returned.
+func (p *parser) list(sep, end token, parse func()) Pos {
 	for p.tok != end && p.tok != _EOF {
 		parse()
 
@@ -83,17 +81,21 @@ func (p *parser) list(sep, end token, parse func()) {
 			p.next()
 		}
 	}
+
+	pos := p.pos
 	p.want(end)
-}
 
-func (p *parser) block() *block {
-	p.want(_Lbrace)
+	return pos
+}
 
-	n := &block{
+func (p *parser) block() *Block {
+	n := &Block{
 		baseNode: p.node(),
 	}
 
-	p.list(_Semi, _Rbrace, func() {
+	p.want(_Lbrace)
+
+	n.Rbrace = p.list(_Semi, _Rbrace, func() {
 		if p.tok != _Name {
 			p.expected(_Name)
 			p.advance(_Rbrace, _Semi)
@@ -104,21 +106,21 @@ func (p *parser) block() *block {
 	return n
 }
 
-func (p *parser) arr() *array {
-	p.want(_Lbrack)
-
-	n := &array{
+func (p *parser) arr() *Array {
+	n := &Array{
 		baseNode: p.node(),
 	}
 
-	p.list(_Comma, _Rbrack, func() {
+	p.want(_Lbrack)
+
+	n.Rbrack = p.list(_Comma, _Rbrack, func() {
 		n.Items = append(n.Items, p.operand())
 	})
 	return n
 }
 
-func (p *parser) operand() node {
-	var n node
+func (p *parser) operand() Node {
+	var n Node
 
 	switch p.tok {
 	case _Literal:
@@ -136,10 +138,11 @@ func (p *parser) operand() node {
 			break
 		}
 
-		n = &lit{
+		n = &Lit{
 			baseNode: name.baseNode,
 			Type:     BoolLit,
 			Value:    name.Value,
+			Raw:      name.Value,
 		}
 	default:
 		p.unexpected(p.tok)
@@ -154,12 +157,12 @@ func (p *parser) node() baseNode {
 	}
 }
 
-func (p *parser) name() *name {
+func (p *parser) name() *Name {
 	if p.tok != _Name {
 		return nil
 	}
 
-	n := &name{
+	n := &Name{
 		baseNode: p.node(),
 		Value:    p.lit,
 	}
@@ -168,15 +171,16 @@ func (p *parser) name() *name {
 	return n
 }
 
-func (p *parser) param() *param {
+func (p *parser) param() *Param {
 	if p.tok != _Name {
 		p.unexpected(p.tok)
 		p.advance(_Semi)
 		return nil
 	}
 
-	n := &param{
+	n := &Param{
 		baseNode: p.node(),
+		Doc:      p.doc(),
 		Name:     p.name(),
 	}
 
@@ -185,23 +189,56 @@ func (p *parser) param() *param {
 
 		if p.tok == _Semi {
 			if n.Label.Value == "true" || n.Label.Value == "false" {
-				n.Value = &lit{
+				n.Value = &Lit{
 					baseNode: n.Label.baseNode,
 					Type:     BoolLit,
 					Value:    n.Label.Value,
+					Raw:      n.Label.Value,
 				}
 				n.Label = nil
 			}
+			n.Comment = p.lineComment(n.End().Line)
 			return n
 		}
 	}
 
 	n.Value = p.operand()
+	n.Comment = p.lineComment(n.End().Line)
 
 	return n
 }
 
-func (p *parser) include() []node {
+// doc returns the group of comments directly above the current token, if
+// any.
+func (p *parser) doc() *CommentGroup {
+	if len(p.comments) == 0 {
+		return nil
+	}
+
+	g := p.comments[len(p.comments)-1]
+
+	if g.line || g.End().Line != p.pos.Line-1 {
+		return nil
+	}
+	return g
+}
+
+// lineComment returns the comment following the last token on the given line,
+// if any.
+func (p *parser) lineComment(line int) *CommentGroup {
+	if len(p.comments) == 0 {
+		return nil
+	}
+
+	g := p.comments[len(p.comments)-1]
+
+	if !g.line || g.Pos().Line != line {
+		return nil
+	}
+	return g
+}
+
+func (p *parser) include() []Node {
 	files := make([]string, 0)
 
 	switch p.tok {
@@ -217,7 +254,7 @@ func (p *parser) include() []node {
 		arr := p.arr()
 
 		for _, it := range arr.Items {
-			lit, ok := it.(*lit)
+			lit, ok := it.(*Lit)
 
 			if !ok {
 				p.err("expected string literal in include array")
@@ -235,7 +272,7 @@ func (p *parser) include() []node {
 		return nil
 	}
 
-	nn := make([]node, 0)
+	nn := make([]Node, 0)
 
 	for _, file := range files {
 		if file == p.scanner.name {
@@ -268,6 +305,9 @@ func (p *parser) include() []node {
 			inc, err := p.parse()
 
 			if err != nil {
+				if errs, ok := err.(ErrorList); ok {
+					return errs
+				}
 				return err
 			}
 
@@ -276,6 +316,10 @@ func (p *parser) include() []node {
 		}(file)
 
 		if err != nil {
+			if errs, ok := err.(ErrorList); ok {
+				p.errs = append(p.errs, errs...)
+				break
+			}
 			p.err(err.Error())
 			break
 		}
@@ -283,8 +327,8 @@ func (p *parser) include() []node {
 	return nn
 }
 
-func (p *parser) parse() ([]node, error) {
-	nn := make([]node, 0)
+func (p *parser) parse() ([]Node, error) {
+	nn := make([]Node, 0)
 
 	for p.tok != _EOF {
 		if p.tok == _Semi {
@@ -304,8 +348,68 @@ func (p *parser) parse() ([]node, error) {
 		nn = append(nn, p.param())
 	}
 
-	if p.errc > 0 {
-		return nil, fmt.Errorf("parser encountered %d error(s)", p.errc)
+	if len(p.errs) > 0 {
+		p.errs.RemoveMultiples()
+		return nil, p.errs
 	}
 	return nn, nil
 }
+
+// parseOperand parses the given string as a single operand, such as the value
+// of a default struct tag. The name is used to identify the source in the
+// positions of any errors.
+func parseOperand(name, s string) (Node, error) {
+	p := parser{
+		scanner: newScanner(newSource(name, strings.NewReader(s), nil)),
+	}
+
+	n := p.operand()
+
+	for p.tok == _Semi {
+		p.next()
+	}
+
+	if p.tok != _EOF {
+		p.unexpected(p.tok)
+	}
+
+	if len(p.errs) > 0 {
+		p.errs.RemoveMultiples()
+		return nil, p.errs
+	}
+	return n, nil
+}
+
+// Parse parses the configuration from the given reader and returns the parse
+// tree for it. The name is used to identify the source in the positions of
+// each node. Includes are not followed, and are instead returned as regular
+// parameters. If any errors occur during parsing then they are returned as an
+// ErrorList.
+func Parse(name string, r io.Reader) (*File, error) {
+	p := parser{
+		scanner: newScanner(newSource(name, r, nil)),
+		inctab:  make(map[string]string),
+	}
+
+	f := &File{
+		baseNode: p.node(),
+		Name:     name,
+	}
+
+	nn, err := p.parse()
+
+	if err != nil {
+		return nil, err
+	}
+
+	f.Params = make([]*Param, 0, len(nn))
+
+	for _, n := range nn {
+		f.Params = append(f.Params, n.(*Param))
+	}
+
+	f.eof = p.pos
+	f.Comments = p.comments
+
+	return f, nil
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -12,13 +13,13 @@ func errh(t *testing.T) func(Pos, string) {
 	}
 }
 
-func checkname(t *testing.T, expected, actual *name) {
+func checkname(t *testing.T, expected, actual *Name) {
 	if expected.Value != actual.Value {
 		t.Errorf("%s - unexpected name.Value, expected=%q, got=%q\n", actual.Pos(), expected.Value, actual.Value)
 	}
 }
 
-func checklit(t *testing.T, expected, actual *lit) {
+func checklit(t *testing.T, expected, actual *Lit) {
 	if expected.Value != actual.Value {
 		t.Errorf("%s - unexpected lit.Value, expected=%q, got=%q\n", actual.Pos(), expected.Value, actual.Value)
 	}
@@ -28,7 +29,7 @@ func checklit(t *testing.T, expected, actual *lit) {
 	}
 }
 
-func checkparam(t *testing.T, expected, actual *param) {
+func checkparam(t *testing.T, expected, actual *Param) {
 	checkname(t, expected.Name, actual.Name)
 
 	if expected.Label != nil {
@@ -41,7 +42,7 @@ func checkparam(t *testing.T, expected, actual *param) {
 	checkNode(t, expected.Value, actual.Value)
 }
 
-func checkBlock(t *testing.T, expected, actual *block) {
+func checkBlock(t *testing.T, expected, actual *Block) {
 	if l := len(expected.Params); l != len(actual.Params) {
 		t.Errorf("%s - unexpected block.Params length, expected=%d, got=%d\n", actual.Pos(), l, len(actual.Params))
 		return
@@ -52,7 +53,7 @@ func checkBlock(t *testing.T, expected, actual *block) {
 	}
 }
 
-func checkArray(t *testing.T, expected, actual *array) {
+func checkArray(t *testing.T, expected, actual *Array) {
 	if l := len(expected.Items); l != len(actual.Items) {
 		t.Errorf("%s - unexpected array.Items length, expected=%d, got=%d\n", actual.Pos(), l, len(actual.Items))
 		return
@@ -63,42 +64,42 @@ func checkArray(t *testing.T, expected, actual *array) {
 	}
 }
 
-func checkNode(t *testing.T, expected, actual node) {
+func checkNode(t *testing.T, expected, actual Node) {
 	switch v := expected.(type) {
-	case *name:
-		name, ok := actual.(*name)
+	case *Name:
+		name, ok := actual.(*Name)
 
 		if !ok {
 			t.Errorf("%s - unexpected node type, expected=%T, got=%T\n", actual.Pos(), v, actual)
 			return
 		}
 		checkname(t, v, name)
-	case *lit:
-		lit, ok := actual.(*lit)
+	case *Lit:
+		lit, ok := actual.(*Lit)
 
 		if !ok {
 			t.Errorf("%s - unexpected node type, expected=%T, got=%T\n", actual.Pos(), v, actual)
 			return
 		}
 		checklit(t, v, lit)
-	case *param:
-		param, ok := actual.(*param)
+	case *Param:
+		param, ok := actual.(*Param)
 
 		if !ok {
 			t.Errorf("%s - unexpected node type, expected=%T, got=%T\n", actual.Pos(), v, actual)
 			return
 		}
 		checkparam(t, v, param)
-	case *block:
-		block, ok := actual.(*block)
+	case *Block:
+		block, ok := actual.(*Block)
 
 		if !ok {
 			t.Errorf("%s - unexpected node type, expected=%T, got=%T\n", actual.Pos(), v, actual)
 			return
 		}
 		checkBlock(t, v, block)
-	case *array:
-		array, ok := actual.(*array)
+	case *Array:
+		array, ok := actual.(*Array)
 
 		if !ok {
 			t.Errorf("%s - unexpected node type, expected=%T, got=%T\n", actual.Pos(), v, actual)
@@ -130,40 +131,40 @@ func Test_Parser(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	expected := []node{
-		&param{
-			Name:  &name{Value: "log"},
-			Label: &name{Value: "debug"},
-			Value: &lit{
+	expected := []Node{
+		&Param{
+			Name:  &Name{Value: "log"},
+			Label: &Name{Value: "debug"},
+			Value: &Lit{
 				Value: "/dev/stdout",
 				Type:  StringLit,
 			},
 		},
-		&param{
-			Name: &name{Value: "net"},
-			Value: &block{
-				Params: []*param{
+		&Param{
+			Name: &Name{Value: "net"},
+			Value: &Block{
+				Params: []*Param{
 					{
-						Name: &name{Value: "listen"},
-						Value: &lit{
+						Name: &Name{Value: "listen"},
+						Value: &Lit{
 							Value: "localhost:443",
 							Type:  StringLit,
 						},
 					},
 					{
-						Name: &name{Value: "tls"},
-						Value: &block{
-							Params: []*param{
+						Name: &Name{Value: "tls"},
+						Value: &Block{
+							Params: []*Param{
 								{
-									Name: &name{Value: "cert"},
-									Value: &lit{
+									Name: &Name{Value: "cert"},
+									Value: &Lit{
 										Value: "/var/lib/ssl/server.crt",
 										Type:  StringLit,
 									},
 								},
 								{
-									Name: &name{Value: "key"},
-									Value: &lit{
+									Name: &Name{Value: "key"},
+									Value: &Lit{
 										Value: "/var/lib/ssl/server.key",
 										Type:  StringLit,
 									},
@@ -174,32 +175,32 @@ func Test_Parser(t *testing.T) {
 				},
 			},
 		},
-		&param{
-			Name: &name{Value: "drivers"},
-			Value: &array{
-				Items: []node{
-					&lit{
+		&Param{
+			Name: &Name{Value: "drivers"},
+			Value: &Array{
+				Items: []Node{
+					&Lit{
 						Value: "docker",
 						Type:  StringLit,
 					},
-					&lit{
+					&Lit{
 						Value: "qemu-x86_64",
 						Type:  StringLit,
 					},
 				},
 			},
 		},
-		&param{
-			Name: &name{Value: "cache"},
-			Value: &block{
-				Params: []*param{
+		&Param{
+			Name: &Name{Value: "cache"},
+			Value: &Block{
+				Params: []*Param{
 					{
-						Name: &name{Value: "redis"},
-						Value: &block{
-							Params: []*param{
+						Name: &Name{Value: "redis"},
+						Value: &Block{
+							Params: []*Param{
 								{
-									Name: &name{Value: "addr"},
-									Value: &lit{
+									Name: &Name{Value: "addr"},
+									Value: &Lit{
 										Value: "localhost:6379",
 										Type:  StringLit,
 									},
@@ -208,8 +209,8 @@ func Test_Parser(t *testing.T) {
 						},
 					},
 					{
-						Name: &name{Value: "cleanup_interval"},
-						Value: &lit{
+						Name: &Name{Value: "cleanup_interval"},
+						Value: &Lit{
 							Value: "1h",
 							Type:  DurationLit,
 						},
@@ -217,28 +218,28 @@ func Test_Parser(t *testing.T) {
 				},
 			},
 		},
-		&param{
-			Name:  &name{Value: "store"},
-			Label: &name{Value: "files"},
-			Value: &block{
-				Params: []*param{
+		&Param{
+			Name:  &Name{Value: "store"},
+			Label: &Name{Value: "files"},
+			Value: &Block{
+				Params: []*Param{
 					{
-						Name: &name{Value: "type"},
-						Value: &lit{
+						Name: &Name{Value: "type"},
+						Value: &Lit{
 							Value: "file",
 							Type:  StringLit,
 						},
 					},
 					{
-						Name: &name{Value: "path"},
-						Value: &lit{
+						Name: &Name{Value: "path"},
+						Value: &Lit{
 							Value: "/var/lib/files",
 							Type:  StringLit,
 						},
 					},
 					{
-						Name: &name{Value: "limit"},
-						Value: &lit{
+						Name: &Name{Value: "limit"},
+						Value: &Lit{
 							Value: "50MB",
 							Type:  SizeLit,
 						},
@@ -256,3 +257,327 @@ func Test_Parser(t *testing.T) {
 		checkNode(t, expected[i], n)
 	}
 }
+
+func Test_ParseInspect(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "server.conf"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	file, err := Parse(f.Name(), f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := make(map[string]int)
+
+	Inspect(file, func(n Node) bool {
+		switch v := n.(type) {
+		case *Param:
+			counts["param"]++
+		case *Name:
+			counts["name"]++
+		case *Lit:
+			counts[v.Type.String()]++
+
+			if end := v.End(); end.Line != v.Pos().Line || end.Col <= v.Pos().Col {
+				t.Errorf("%s - unexpected lit.End, got=%s\n", v.Pos(), end)
+			}
+		case *Block:
+			if v.End().Col != v.Rbrace.Col+1 {
+				t.Errorf("%s - unexpected block.End, got=%s\n", v.Pos(), v.End())
+			}
+		}
+		return true
+	})
+
+	expected := map[string]int{
+		"param":    15,
+		"name":     17,
+		"string":   9,
+		"duration": 1,
+		"size":     1,
+	}
+
+	for k, n := range expected {
+		if counts[k] != n {
+			t.Errorf("unexpected number of %s nodes, expected=%d, got=%d\n", k, n, counts[k])
+		}
+	}
+}
+
+func Test_ParseError(t *testing.T) {
+	if _, err := Parse("error.conf", strings.NewReader("block {\n\tparam 10,\n}\n")); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
+
+func Test_ParseComments(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "comments.conf"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	file, err := Parse(f.Name(), f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if l := len(file.Comments); l != 5 {
+		t.Fatalf("unexpected number of comment groups, expected=%d, got=%d\n", 5, l)
+	}
+
+	text := func(g *CommentGroup) string {
+		if g == nil {
+			return ""
+		}
+		return g.Text()
+	}
+
+	net := file.Params[0]
+	listen := net.Value.(*Block).Params[0]
+	tls := net.Value.(*Block).Params[1]
+	cert := tls.Value.(*Block).Params[0]
+	key := tls.Value.(*Block).Params[1]
+
+	tests := []struct {
+		name     string
+		actual   *CommentGroup
+		expected string
+	}{
+		{"net.Doc", net.Doc, "Network configuration for the\nserver."},
+		{"net.Comment", net.Comment, ""},
+		{"listen.Comment", listen.Comment, "Listen on all interfaces."},
+		{"tls.Doc", tls.Doc, ""},
+		{"tls.Comment", tls.Comment, ""},
+		{"cert.Doc", cert.Doc, ""},
+		{"key.Comment", key.Comment, "Never commit this."},
+	}
+
+	for _, test := range tests {
+		if s := text(test.actual); s != test.expected {
+			t.Errorf("unexpected %s, expected=%q, got=%q\n", test.name, test.expected, s)
+		}
+	}
+}
+
+func Test_ParseNumbers(t *testing.T) {
+	tests := []struct {
+		src string
+		typ LitType
+	}{
+		{"10", IntLit},
+		{"-10", IntLit},
+		{"1_000_000", IntLit},
+		{"0x1F", IntLit},
+		{"0x_ff", IntLit},
+		{"0o755", IntLit},
+		{"0b1010", IntLit},
+		{"10.25", FloatLit},
+		{"1e-3", FloatLit},
+		{"1.5E10", FloatLit},
+		{"1_000.5", FloatLit},
+		{"1h30m", DurationLit},
+		{"1.5h", DurationLit},
+		{"10MB", SizeLit},
+		{"1_024B", SizeLit},
+		{"1.5GB", SizeLit},
+		{"10KiB", SizeLit},
+		{"1kB", SizeLit},
+		{"2PiB", SizeLit},
+	}
+
+	for _, test := range tests {
+		f, err := Parse("number.conf", strings.NewReader("n "+test.src))
+
+		if err != nil {
+			t.Errorf("%q: %s\n", test.src, err)
+			continue
+		}
+		checklit(t, &Lit{Value: test.src, Type: test.typ}, f.Params[0].Value.(*Lit))
+	}
+
+	errs := []string{
+		"1.2.3",
+		"10x",
+		"0x",
+		"0xG",
+		"0o8",
+		"0b102",
+		"1__0",
+		"10_",
+		"1e",
+		"1e5s",
+		"0x10s",
+		"1h30",
+		"1h30x",
+		"10K",
+		"10kiB",
+		"0x10MB",
+		"-",
+	}
+
+	for _, src := range errs {
+		_, err := Parse("number.conf", strings.NewReader("n "+src))
+
+		if err == nil {
+			t.Errorf("%q: expected error, got nil\n", src)
+			continue
+		}
+
+		if expected := "number.conf,1:3 - malformed number " + src; err.Error() != expected {
+			t.Errorf("%q: unexpected error, expected=%q, got=%q\n", src, expected, err.Error())
+		}
+	}
+}
+
+func Test_ParseStrings(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "strings.conf"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	file, err := Parse(f.Name(), f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		lit   *Lit
+		value string
+		raw   string
+		end   Pos
+	}{
+		{
+			file.Params[0].Value.(*Lit),
+			`say "hi"`,
+			`"say \"hi\""`,
+			Pos{Line: 1, Col: 20},
+		},
+		{
+			file.Params[1].Value.(*Lit),
+			`C:\dir\${name}`,
+			"`C:\\dir\\${name}`",
+			Pos{Line: 2, Col: 24},
+		},
+		{
+			file.Params[2].Value.(*Lit),
+			"\nSELECT *\nFROM users",
+			"`\nSELECT *\nFROM users`",
+			Pos{Line: 6, Col: 12},
+		},
+		{
+			file.Params[3].Value.(*Lit),
+			"-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n",
+			"<<EOF\n-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\nEOF",
+			Pos{Line: 12, Col: 4},
+		},
+		{
+			file.Params[4].Value.(*Block).Params[0].Value.(*Lit),
+			"Hello ${name},\n\n  Welcome.\n",
+			"<<-EOT\n\t\tHello ${name},\n\n\t\t  Welcome.\n\t\tEOT",
+			Pos{Line: 19, Col: 6},
+		},
+	}
+
+	for _, test := range tests {
+		if test.lit.Type != StringLit {
+			t.Errorf("%s - unexpected lit.Type, expected=%s, got=%s\n", test.lit.Pos(), StringLit, test.lit.Type)
+		}
+
+		if test.lit.Value != test.value {
+			t.Errorf("%s - unexpected lit.Value, expected=%q, got=%q\n", test.lit.Pos(), test.value, test.lit.Value)
+		}
+
+		if test.lit.Raw != test.raw {
+			t.Errorf("%s - unexpected lit.Raw, expected=%q, got=%q\n", test.lit.Pos(), test.raw, test.lit.Raw)
+		}
+
+		if end := test.lit.End(); end.Line != test.end.Line || end.Col != test.end.Col {
+			t.Errorf("%s - unexpected lit.End, expected=%d:%d, got=%d:%d\n", test.lit.Pos(), test.end.Line, test.end.Col, end.Line, end.Col)
+		}
+	}
+
+	errs := []string{
+		"s `unterminated",
+		"s <<EOF\nno end\n",
+		"s <<\nEOF\n",
+		"s <<EOF trailing\nEOF\n",
+		"s <EOF\n",
+		"s \"unterminated\n",
+	}
+
+	for _, src := range errs {
+		if _, err := Parse("strings.conf", strings.NewReader(src)); err == nil {
+			t.Errorf("%q: expected error, got nil\n", src)
+		}
+	}
+}
+
+func Test_ParseEscapes(t *testing.T) {
+	tests := []struct {
+		src   string
+		value string
+	}{
+		{`"line\nline"`, "line\nline"},
+		{`"tab\there"`, "tab\there"},
+		{`"C:\\dir"`, `C:\dir`},
+		{`"say \"hi\""`, `say "hi"`},
+		{`"caf\u00e9"`, "café"},
+		{`"\U0001F600"`, "\U0001F600"},
+		{`"\x41\102"`, "AB"},
+		{`"\a\b\f\r\v"`, "\a\b\f\r\v"},
+		{`"$${HOME}"`, "$${HOME}"},
+	}
+
+	for _, test := range tests {
+		f, err := Parse("escape.conf", strings.NewReader("s "+test.src))
+
+		if err != nil {
+			t.Errorf("%s: %s\n", test.src, err)
+			continue
+		}
+
+		if lit := f.Params[0].Value.(*Lit); lit.Value != test.value {
+			t.Errorf("%s: unexpected lit.Value, expected=%q, got=%q\n", test.src, test.value, lit.Value)
+		}
+	}
+
+	errs := []struct {
+		src string
+		err string
+	}{
+		{`"\q"`, "escape.conf,1:4 - unknown escape sequence"},
+		{`"ok \$"`, "escape.conf,1:7 - unknown escape sequence"},
+		{`"\x4"`, "escape.conf,1:4 - invalid character in escape sequence"},
+		{`"\u00g9"`, "escape.conf,1:4 - invalid character in escape sequence"},
+		{`"\uD800"`, "escape.conf,1:4 - escape sequence is invalid Unicode code point"},
+		{`"\U00110000"`, "escape.conf,1:4 - escape sequence is invalid Unicode code point"},
+		{`"\400"`, "escape.conf,1:4 - escape sequence is invalid Unicode code point"},
+	}
+
+	for _, test := range errs {
+		_, err := Parse("escape.conf", strings.NewReader("s "+test.src))
+
+		if err == nil {
+			t.Errorf("%s: expected error, got nil\n", test.src)
+			continue
+		}
+
+		if err.Error() != test.err {
+			t.Errorf("%s: unexpected error, expected=%q, got=%q\n", test.src, test.err, err.Error())
+		}
+	}
+}
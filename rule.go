@@ -0,0 +1,283 @@
+package config
+
+import (
+	"cmp"
+	"errors"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// RuleFunc is a custom validation rule that can be used in the validate struct
+// tag. It is given the value being validated, and the argument given to the
+// rule in the tag, if any. An error is returned if the value is not valid.
+type RuleFunc func(v interface{}, arg string) error
+
+// Rule registers a custom validation rule with the given name, for use in the
+// validate struct tag. This will replace any builtin rule of the same name.
+func Rule(name string, fn RuleFunc) Option {
+	return func(d *Decoder) *Decoder {
+		if d.rules == nil {
+			d.rules = make(map[string]RuleFunc)
+		}
+		d.rules[name] = fn
+		return d
+	}
+}
+
+type rule struct {
+	name string
+	arg  string
+}
+
+// parseRules parses the rules in the given validate struct tag. Rules are
+// separated by a comma, and the argument for a rule is given after an =. A
+// comma in an argument can be escaped with \,.
+func parseRules(tag string) []rule {
+	rules := make([]rule, 0)
+
+	var buf strings.Builder
+
+	add := func() {
+		s := buf.String()
+		buf.Reset()
+
+		if s == "" {
+			return
+		}
+
+		name, arg, _ := strings.Cut(s, "=")
+
+		rules = append(rules, rule{
+			name: name,
+			arg:  arg,
+		})
+	}
+
+	for i := 0; i < len(tag); i++ {
+		b := tag[i]
+
+		if b == '\\' && i+1 < len(tag) && tag[i+1] == ',' {
+			buf.WriteByte(',')
+			i++
+			continue
+		}
+
+		if b == ',' {
+			add()
+			continue
+		}
+		buf.WriteByte(b)
+	}
+	add()
+
+	return rules
+}
+
+// ruletab is the table of builtin validation rules.
+var ruletab = map[string]func(d *Decoder, rv reflect.Value, arg string) error{
+	"min":      (*Decoder).ruleMin,
+	"max":      (*Decoder).ruleMax,
+	"len":      (*Decoder).ruleLen,
+	"oneof":    (*Decoder).ruleOneof,
+	"pattern":  (*Decoder).rulePattern,
+	"nonempty": (*Decoder).ruleNonempty,
+}
+
+// checkRules checks the value against each rule in the given validate struct
+// tag. Pointers are followed, with nil pointers being checked as the zero
+// value. Any error is positioned at the given position.
+func (d *Decoder) checkRules(tag string, rv reflect.Value, pos Pos) error {
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			rv = reflect.Zero(rv.Type().Elem())
+			continue
+		}
+		rv = rv.Elem()
+	}
+
+	for _, r := range parseRules(tag) {
+		var err error
+
+		if fn, ok := d.rules[r.name]; ok {
+			err = fn(rv.Interface(), r.arg)
+		} else if fn, ok := ruletab[r.name]; ok {
+			err = fn(d, rv, r.arg)
+		} else {
+			err = errors.New("unknown validation rule " + r.name)
+		}
+
+		if err != nil {
+			return &Error{
+				Pos: pos,
+				Msg: err.Error(),
+				Err: err,
+			}
+		}
+	}
+	return nil
+}
+
+// decodeBound decodes the argument of a rule into a value of the given type.
+// The argument is parsed as a literal, so bounds can be given as durations, or
+// sizes, such as 1s, or 1GB, and are decoded with the options of the Decoder,
+// such as LegacySizes.
+func (d *Decoder) decodeBound(rt reflect.Type, arg string) (reflect.Value, error) {
+	n, err := parseTag("validate", rt, arg)
+
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	lit, ok := n.(*Lit)
+
+	if !ok {
+		return reflect.Value{}, errors.New("invalid argument " + arg)
+	}
+
+	rv, err := d.decodeLiteral(rt, lit)
+
+	if err != nil {
+		return rv, err
+	}
+	return rv.Convert(rt), nil
+}
+
+func hasLen(kind reflect.Kind) bool {
+	return kind == reflect.String || kind == reflect.Slice || kind == reflect.Map || kind == reflect.Array
+}
+
+// compare compares the value to the given bound. Strings, slices, and maps are
+// compared by their length, and numbers by their value.
+func (d *Decoder) compare(rv reflect.Value, bound string) (int, error) {
+	kind := rv.Kind()
+
+	if hasLen(kind) {
+		n, err := strconv.Atoi(bound)
+
+		if err != nil {
+			return 0, errors.New("invalid length " + bound)
+		}
+		return cmp.Compare(rv.Len(), n), nil
+	}
+
+	if !isNumber(kind) {
+		return 0, errors.New("cannot compare " + rv.Type().String())
+	}
+
+	bv, err := d.decodeBound(rv.Type(), bound)
+
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case isInt(kind):
+		return cmp.Compare(rv.Int(), bv.Int()), nil
+	case isUint(kind):
+		return cmp.Compare(rv.Uint(), bv.Uint()), nil
+	}
+	return cmp.Compare(rv.Float(), bv.Float()), nil
+}
+
+// boundMsg returns the message for a value that is not within the given bound.
+func boundMsg(rv reflect.Value, cond, bound string) string {
+	if hasLen(rv.Kind()) {
+		return "length must be " + cond + " " + bound
+	}
+	return "must be " + cond + " " + bound
+}
+
+func (d *Decoder) ruleMin(rv reflect.Value, arg string) error {
+	c, err := d.compare(rv, arg)
+
+	if err != nil {
+		return err
+	}
+
+	if c < 0 {
+		return errors.New(boundMsg(rv, "at least", arg))
+	}
+	return nil
+}
+
+func (d *Decoder) ruleMax(rv reflect.Value, arg string) error {
+	c, err := d.compare(rv, arg)
+
+	if err != nil {
+		return err
+	}
+
+	if c > 0 {
+		return errors.New(boundMsg(rv, "at most", arg))
+	}
+	return nil
+}
+
+func (d *Decoder) ruleLen(rv reflect.Value, arg string) error {
+	if !hasLen(rv.Kind()) {
+		return errors.New("cannot take length of " + rv.Type().String())
+	}
+
+	c, err := d.compare(rv, arg)
+
+	if err != nil {
+		return err
+	}
+
+	if c != 0 {
+		return errors.New(boundMsg(rv, "exactly", arg))
+	}
+	return nil
+}
+
+// ruleOneof checks that the value is one of the space separated values in
+// the argument.
+func (d *Decoder) ruleOneof(rv reflect.Value, arg string) error {
+	opts := strings.Fields(arg)
+
+	for _, opt := range opts {
+		ov, err := d.decodeBound(rv.Type(), opt)
+
+		if err != nil {
+			return err
+		}
+
+		if reflect.DeepEqual(rv.Interface(), ov.Interface()) {
+			return nil
+		}
+	}
+	return errors.New("must be one of " + strings.Join(opts, ", "))
+}
+
+func (d *Decoder) rulePattern(rv reflect.Value, arg string) error {
+	if rv.Kind() != reflect.String {
+		return errors.New("cannot match pattern against " + rv.Type().String())
+	}
+
+	re, err := regexp.Compile(arg)
+
+	if err != nil {
+		return errors.New("invalid pattern " + arg)
+	}
+
+	if !re.MatchString(rv.String()) {
+		return errors.New("must match pattern " + arg)
+	}
+	return nil
+}
+
+func (d *Decoder) ruleNonempty(rv reflect.Value, _ string) error {
+	if hasLen(rv.Kind()) {
+		if rv.Len() == 0 {
+			return errors.New("must not be empty")
+		}
+		return nil
+	}
+
+	if rv.IsZero() {
+		return errors.New("must not be empty")
+	}
+	return nil
+}
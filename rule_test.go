@@ -0,0 +1,203 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_ParseRules(t *testing.T) {
+	tests := []struct {
+		tag      string
+		expected []rule
+	}{
+		{"", []rule{}},
+		{"nonempty", []rule{{name: "nonempty"}}},
+		{"min=1s,max=1h", []rule{{name: "min", arg: "1s"}, {name: "max", arg: "1h"}}},
+		{`pattern=^[a-z]{1\,3}$,nonempty`, []rule{{name: "pattern", arg: "^[a-z]{1,3}$"}, {name: "nonempty"}}},
+		{"oneof=debug info error", []rule{{name: "oneof", arg: "debug info error"}}},
+	}
+
+	for _, test := range tests {
+		rules := parseRules(test.tag)
+
+		if !reflect.DeepEqual(rules, test.expected) {
+			t.Errorf("%q: unexpected rules, expected=%v, got=%v\n", test.tag, test.expected, rules)
+		}
+	}
+}
+
+func Test_DecodeRules(t *testing.T) {
+	type Config struct {
+		Name    string        `validate:"nonempty,pattern=^[a-z]+$"`
+		Level   string        `validate:"oneof=debug info error"`
+		Workers int           `validate:"min=1,max=64"`
+		Ratio   float64       `validate:"min=0.5"`
+		Timeout time.Duration `validate:"min=1s,max=1h"`
+		Limit   Size          `validate:"max=1GB"`
+		Hosts   []string      `validate:"min=1,max=2"`
+		Key     string        `validate:"len=4"`
+		Port    *uint16       `validate:"nonempty"`
+		Code    int           `validate:"oneof=200 204"`
+		Mode    string        `validate:"even"`
+
+		Log map[string]struct {
+			File string `validate:"pattern=^/"`
+		}
+	}
+
+	tests := []struct {
+		src string
+		err string
+	}{
+		{`name "web"`, ""},
+		{`name ""`, `config: rules.conf,1:6 - cannot decode "name" into field Name of type string: must not be empty`},
+		{`name "Web"`, `config: rules.conf,1:6 - cannot decode "name" into field Name of type string: must match pattern ^[a-z]+$`},
+		{`level "info"`, ""},
+		{`level "trace"`, `config: rules.conf,1:7 - cannot decode "level" into field Level of type string: must be one of debug, info, error`},
+		{`workers 64`, ""},
+		{`workers 0`, `config: rules.conf,1:9 - cannot decode "workers" into field Workers of type int: must be at least 1`},
+		{`workers 65`, `config: rules.conf,1:9 - cannot decode "workers" into field Workers of type int: must be at most 64`},
+		{`ratio 0.25`, `config: rules.conf,1:7 - cannot decode "ratio" into field Ratio of type float64: must be at least 0.5`},
+		{`timeout 500ms`, `config: rules.conf,1:9 - cannot decode "timeout" into field Timeout of type time.Duration: must be at least 1s`},
+		{`timeout 1h`, ""},
+		{`limit 2GB`, `config: rules.conf,1:7 - cannot decode "limit" into field Limit of type config.Size: must be at most 1GB`},
+		{`hosts []`, `config: rules.conf,1:7 - cannot decode "hosts" into field Hosts of type []string: length must be at least 1`},
+		{`hosts ["a", "b", "c"]`, `config: rules.conf,1:7 - cannot decode "hosts" into field Hosts of type []string: length must be at most 2`},
+		{`key "abc"`, `config: rules.conf,1:5 - cannot decode "key" into field Key of type string: length must be exactly 4`},
+		{`port 0`, `config: rules.conf,1:6 - cannot decode "port" into field Port of type *uint16: must not be empty`},
+		{`code 204`, ""},
+		{`code 500`, `config: rules.conf,1:6 - cannot decode "code" into field Code of type int: must be one of 200, 204`},
+		{`mode "odd"`, `config: rules.conf,1:6 - cannot decode "mode" into field Mode of type string: must have even length`},
+		{"log access {\n\tfile \"access.log\"\n}", `config: rules.conf,2:7 - cannot decode "log.access.file" into field File of type string: must match pattern ^/`},
+	}
+
+	even := func(v interface{}, _ string) error {
+		if len(v.(string))%2 != 0 {
+			return errors.New("must have even length")
+		}
+		return nil
+	}
+
+	for _, test := range tests {
+		var cfg Config
+
+		err := NewDecoder("rules.conf", ErrorHandler(errh(t)), Rule("even", even)).Decode(&cfg, strings.NewReader(test.src))
+
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%q: unexpected error: %s\n", test.src, err)
+			}
+			continue
+		}
+
+		if err == nil || err.Error() != test.err {
+			t.Errorf("%q: unexpected error, expected=%q, got=%v\n", test.src, test.err, err)
+		}
+	}
+
+	typed := []struct {
+		src  string
+		opts []Option
+		v    interface{}
+		err  string
+	}{
+		{
+			"",
+			nil,
+			&struct {
+				Level string `validate:"oneof=debug info"`
+			}{},
+			"",
+		},
+		{
+			"net {\n}",
+			nil,
+			&struct {
+				Net struct {
+					Listen string `validate:"nonempty"`
+				}
+			}{},
+			"",
+		},
+		{
+			"",
+			nil,
+			&struct {
+				Workers int `default:"0" validate:"min=1"`
+			}{},
+			`config: rules.conf - cannot decode "workers" into field Workers of type int: must be at least 1`,
+		},
+		{
+			"net {\n}",
+			nil,
+			&struct {
+				Net struct {
+					Workers int `default:"128" validate:"max=64"`
+				}
+			}{},
+			`config: rules.conf,1:5 - cannot decode "net.workers" into field Workers of type int: must be at most 64`,
+		},
+		{
+			"limit 1GB",
+			[]Option{LegacySizes},
+			&struct {
+				Limit Size `validate:"max=1GB"`
+			}{},
+			"",
+		},
+		{
+			"limit 1GiB",
+			nil,
+			&struct {
+				Limit Size `validate:"max=1GB"`
+			}{},
+			`config: rules.conf,1:7 - cannot decode "limit" into field Limit of type config.Size: must be at most 1GB`,
+		},
+		{
+			"log access {}",
+			nil,
+			&struct {
+				Log map[string]struct{} `validate:"len=1"`
+			}{},
+			"",
+		},
+		{
+			"log access {}\nlog error {}",
+			nil,
+			&struct {
+				Log map[string]struct{} `validate:"len=1"`
+			}{},
+			`config: rules.conf,1:1 - cannot decode "log" into field Log of type map[string]struct {}: length must be exactly 1`,
+		},
+	}
+
+	for _, test := range typed {
+		opts := append([]Option{ErrorHandler(errh(t))}, test.opts...)
+
+		err := NewDecoder("rules.conf", opts...).Decode(test.v, strings.NewReader(test.src))
+
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%q: unexpected error: %s\n", test.src, err)
+			}
+			continue
+		}
+
+		if err == nil || err.Error() != test.err {
+			t.Errorf("%q: unexpected error, expected=%q, got=%v\n", test.src, test.err, err)
+		}
+	}
+
+	var cfg struct {
+		Name string `validate:"unique"`
+	}
+
+	err := NewDecoder("rules.conf", ErrorHandler(errh(t))).Decode(&cfg, strings.NewReader(`name "web"`))
+
+	if expected := "unknown validation rule unique"; err == nil || !strings.HasSuffix(err.Error(), expected) {
+		t.Fatalf("unexpected error, expected suffix=%q, got=%v\n", expected, err)
+	}
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"strings"
 	"unicode"
 )
 
@@ -13,6 +14,11 @@ type scanner struct {
 	tok    token
 	typ    LitType
 	lit    string
+	raw    string
+
+	// comments records each group of comments that has been scanned in the
+	// source, these are not returned as tokens.
+	comments []*CommentGroup
 }
 
 func newScanner(src *source) *scanner {
@@ -46,101 +52,548 @@ func (sc *scanner) ident() {
 	sc.lit = sc.stopLit()
 }
 
-func (sc *scanner) number() {
+func isBaseDigit(r rune, base int) bool {
+	switch base {
+	case 2:
+		return r == '0' || r == '1'
+	case 8:
+		return '0' <= r && r <= '7'
+	case 16:
+		return isDigit(r) || 'a' <= r && r <= 'f' || 'A' <= r && r <= 'F'
+	}
+	return isDigit(r)
+}
+
+// digits scans the digits of a number in the given base starting with r. The
+// digits may be separated by a single _. This returns the first rune following
+// the digits, the number of digits scanned, and whether each _ was followed by
+// a digit.
+func (sc *scanner) digits(r rune, base int) (rune, int, bool) {
+	n := 0
+	ok := true
+
+	for {
+		if r == '_' {
+			if r = sc.get(); !isBaseDigit(r, base) {
+				ok = false
+				break
+			}
+		}
+
+		if !isBaseDigit(r, base) {
+			break
+		}
+
+		n++
+		r = sc.get()
+	}
+	return r, n, ok
+}
+
+// unit scans the unit suffix of a number literal starting with r. This returns
+// the unit and the first rune following it.
+func (sc *scanner) unit(r rune) (string, rune) {
+	unit := make([]rune, 0, 3)
+
+	for isLetter(r) && r != '_' {
+		unit = append(unit, r)
+		r = sc.get()
+	}
+	return string(unit), r
+}
+
+func isDurationUnit(unit string) bool {
+	_, ok := durtab[unit]
+	return ok
+}
+
+func isSizeUnit(unit string) bool {
+	_, ok := siztab[unit]
+	return ok
+}
+
+// number scans a number literal, the first rune of which, r, has already been
+// read. Integers can be given in hexadecimal, octal, or binary via the 0x, 0o,
+// and 0b prefixes respectively. Decimal numbers can have a fraction and an
+// exponent, and can be suffixed with a unit to make them a duration or size
+// literal. The digits of any number can be separated by _.
+func (sc *scanner) number(r rune) {
 	sc.startLit()
 
-	isFloat := false
 	typ := IntLit
+	base := 10
+	ok := true
 
-	r := sc.get()
+	if r == '-' {
+		r = sc.get()
+	}
 
-	for {
-		if !isDigit(r) {
-			if r == '.' {
-				if isFloat {
-					sc.err("invalid point in float")
-					break
-				}
+	if !isDigit(r) {
+		ok = false
+	}
+
+	if r == '0' {
+		switch r = sc.get(); r {
+		case 'x':
+			base = 16
+		case 'o':
+			base = 8
+		case 'b':
+			base = 2
+		}
 
-				isFloat = true
+		if base != 10 {
+			r = sc.get()
+
+			if r == '_' {
 				r = sc.get()
-				continue
 			}
-			break
 		}
-		r = sc.get()
 	}
-	sc.unget()
 
-	if isFloat {
-		typ = FloatLit
+	r, n, valid := sc.digits(r, base)
+
+	if !valid || base != 10 && n == 0 {
+		ok = false
+	}
+
+	// Only plain decimal numbers can have a unit.
+	plain := base == 10
+
+	if base == 10 {
+		if r == '.' {
+			typ = FloatLit
+
+			if r, _, valid = sc.digits(sc.get(), 10); !valid {
+				ok = false
+			}
+		}
+
+		if r == 'e' || r == 'E' {
+			typ = FloatLit
+			plain = false
+
+			if r = sc.get(); r == '+' || r == '-' {
+				r = sc.get()
+			}
+
+			if r, n, valid = sc.digits(r, 10); !valid || n == 0 {
+				ok = false
+			}
+		}
+	}
+
+	if ok && plain && isLetter(r) {
+		var unit string
+
+		unit, r = sc.unit(r)
+
+		switch {
+		case isSizeUnit(unit):
+			typ = SizeLit
+		case isDurationUnit(unit):
+			typ = DurationLit
+
+			// Durations can be made up of multiple numbers, each with a
+			// unit.
+			for ok && isDigit(r) {
+				if r, _, valid = sc.digits(r, 10); !valid {
+					ok = false
+				}
+
+				if r == '.' {
+					if r, _, valid = sc.digits(sc.get(), 10); !valid {
+						ok = false
+					}
+				}
+
+				if unit, r = sc.unit(r); !isDurationUnit(unit) {
+					ok = false
+				}
+			}
+		default:
+			ok = false
+		}
 	}
 
+	// Consume the rest of a malformed number, such as 1.2.3 or 10x, so it
+	// is reported in full.
+	for isLetter(r) || isDigit(r) || r == '.' {
+		ok = false
+		r = sc.get()
+	}
+	sc.unget()
+
 	sc.nlsemi = true
 	sc.tok = _Literal
 	sc.typ = typ
 	sc.lit = sc.stopLit()
+	sc.raw = sc.lit
+
+	if !ok {
+		sc.errAt(sc.pos, "malformed number "+sc.lit)
+	}
 }
 
+// string scans a quoted string literal. Escape sequences within the string
+// are replaced with the characters they denote.
 func (sc *scanner) string() {
 	sc.startLit()
 
+	var buf strings.Builder
+
 	r := sc.get()
 
-	for {
-		if r == '"' {
+	for r != '"' {
+		if r == '\n' {
+			sc.err("unexpected newline in string")
+			sc.unget()
+			break
+		}
+
+		if r == -1 {
+			sc.err("string not terminated")
 			break
 		}
+
 		if r == '\\' {
+			sc.escape(&buf)
 			r = sc.get()
-
-			if r == '"' {
-				r = sc.get()
-			}
 			continue
 		}
-		if r == '\n' {
-			sc.err("unexpected newline in string")
-			break
+
+		buf.WriteRune(r)
+		r = sc.get()
+	}
+
+	sc.nlsemi = true
+	sc.tok = _Literal
+	sc.typ = StringLit
+	sc.lit = buf.String()
+	sc.raw = sc.stopLit()
+}
+
+func digitVal(r rune) int {
+	switch {
+	case '0' <= r && r <= '9':
+		return int(r - '0')
+	case 'a' <= r && r <= 'f':
+		return int(r - 'a' + 10)
+	case 'A' <= r && r <= 'F':
+		return int(r - 'A' + 10)
+	}
+	return 16
+}
+
+// escape scans the escape sequence following a backslash in a string, and
+// writes the character it denotes to the given builder. The escape sequences
+// are the same as those in Go string literals.
+func (sc *scanner) escape(buf *strings.Builder) {
+	pos := sc.getpos()
+
+	var (
+		n    int
+		base int
+		max  int
+	)
+
+	r := sc.get()
+
+	switch r {
+	case 'a':
+		buf.WriteByte('\a')
+		return
+	case 'b':
+		buf.WriteByte('\b')
+		return
+	case 'f':
+		buf.WriteByte('\f')
+		return
+	case 'n':
+		buf.WriteByte('\n')
+		return
+	case 'r':
+		buf.WriteByte('\r')
+		return
+	case 't':
+		buf.WriteByte('\t')
+		return
+	case 'v':
+		buf.WriteByte('\v')
+		return
+	case '\\', '"':
+		buf.WriteRune(r)
+		return
+	case '0', '1', '2', '3', '4', '5', '6', '7':
+		n, base, max = 3, 8, 255
+		sc.unget()
+	case 'x':
+		n, base, max = 2, 16, 255
+	case 'u':
+		n, base, max = 4, 16, unicode.MaxRune
+	case 'U':
+		n, base, max = 8, 16, unicode.MaxRune
+	default:
+		if r == '\n' || r == -1 {
+			sc.unget()
 		}
+		sc.errAt(pos, "unknown escape sequence")
+		return
+	}
+
+	x := 0
+
+	for ; n > 0; n-- {
 		r = sc.get()
+
+		d := digitVal(r)
+
+		if d >= base {
+			sc.errAt(pos, "invalid character in escape sequence")
+			sc.unget()
+			return
+		}
+		x = x*base + d
 	}
 
-	lit := sc.stopLit()
+	if x > max || max > 255 && 0xD800 <= x && x < 0xE000 {
+		sc.errAt(pos, "escape sequence is invalid Unicode code point")
+		return
+	}
+
+	if max == 255 {
+		buf.WriteByte(byte(x))
+		return
+	}
+	buf.WriteRune(rune(x))
+}
+
+// rawString scans a raw string literal wrapped in a pair of backticks. Raw
+// strings can span multiple lines, and no escapes are processed within them.
+// Carriage returns are removed from the string.
+func (sc *scanner) rawString() {
+	pos := sc.pos
+
+	sc.startLit()
+
+	val := make([]rune, 0)
+
+	r := sc.get()
+
+	for r != '`' {
+		if r == -1 {
+			sc.errAt(pos, "raw string not terminated")
+			break
+		}
+
+		if r != '\r' {
+			val = append(val, r)
+		}
+		r = sc.get()
+	}
 
 	sc.nlsemi = true
 	sc.tok = _Literal
 	sc.typ = StringLit
-	sc.lit = lit[1 : len(lit)-1]
+	sc.lit = string(val)
+	sc.raw = sc.stopLit()
 }
 
-func (sc *scanner) duration(r rune) {
-	lit := []rune(sc.lit)
+// heredoc scans a multi-line string literal. This starts with << followed by
+// an identifier on its own line, and is terminated by the first line that
+// only contains the identifier. Each line in between, including its newline,
+// is part of the string. If the identifier is given as <<- then the closing
+// identifier may be indented, and the indentation common to each line of the
+// string is removed.
+func (sc *scanner) heredoc() {
+	pos := sc.pos
 
-	for r == 's' || r == 'm' || r == 'h' {
-		lit = append(lit, r)
+	sc.startLit()
+
+	defer func() {
+		sc.nlsemi = true
+		sc.tok = _Literal
+		sc.typ = StringLit
+		sc.raw = sc.stopLit()
+	}()
 
+	r := sc.get()
+
+	if r != '<' {
+		sc.errAt(pos, fmt.Sprintf("unexpected token %U", '<'))
+		sc.unget()
+		return
+	}
+
+	strip := false
+
+	if r = sc.get(); r == '-' {
+		strip = true
 		r = sc.get()
+	}
 
-		if isDigit(r) {
-			sc.number()
-			lit = append(lit, []rune(sc.lit)...)
-			r = sc.get()
+	ident := make([]rune, 0)
+
+	for isLetter(r) || isDigit(r) {
+		ident = append(ident, r)
+		r = sc.get()
+	}
+
+	if len(ident) == 0 {
+		sc.errAt(pos, "expected heredoc identifier")
+		sc.unget()
+		return
+	}
+
+	for r == ' ' || r == '\t' || r == '\r' {
+		r = sc.get()
+	}
+
+	if r != '\n' {
+		sc.errAt(pos, "expected newline after heredoc identifier")
+		sc.unget()
+		return
+	}
+
+	lines := make([]string, 0)
+	line := make([]rune, 0)
+
+	for {
+		r = sc.get()
+
+		if r != '\n' && r != -1 {
+			line = append(line, r)
+			continue
+		}
+
+		text := strings.TrimRight(string(line), " \t\r")
+
+		if strip {
+			text = strings.TrimLeft(text, " \t")
 		}
+
+		if text == string(ident) {
+			if r == '\n' {
+				sc.unget()
+			}
+			break
+		}
+
+		if r == -1 {
+			sc.errAt(pos, "heredoc not terminated, expected "+string(ident))
+			break
+		}
+
+		lines = append(lines, strings.TrimSuffix(string(line), "\r"))
+		line = line[0:0]
+	}
+
+	if strip {
+		lines = dedent(lines)
+	}
+
+	var buf strings.Builder
+
+	for _, l := range lines {
+		buf.WriteString(l)
+		buf.WriteByte('\n')
+	}
+	sc.lit = buf.String()
+}
+
+// dedent removes the leading whitespace common to all of the non-blank lines.
+// Blank lines are made empty.
+func dedent(lines []string) []string {
+	prefix := ""
+	first := true
+
+	for _, l := range lines {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+
+		indent := l[:len(l)-len(strings.TrimLeft(l, " \t"))]
+
+		if first {
+			prefix = indent
+			first = false
+			continue
+		}
+
+		i := 0
+
+		for i < len(prefix) && i < len(indent) && prefix[i] == indent[i] {
+			i++
+		}
+		prefix = prefix[:i]
+	}
+
+	for i, l := range lines {
+		if strings.TrimSpace(l) == "" {
+			lines[i] = ""
+			continue
+		}
+		lines[i] = l[len(prefix):]
+	}
+	return lines
+}
+
+// comment scans a comment up to, but not including the end of the line. The
+// newline is left in the source so it can still terminate a parameter. The
+// given line is the line on which the previous token ended, if the comment is
+// on the same line then it is recorded as a line comment in a group of its
+// own, otherwise it is added to the group of comments on the lines directly
+// above it.
+func (sc *scanner) comment(line int) {
+	pos := sc.getpos()
+
+	sc.startLit()
+
+	r := sc.get()
+
+	for r != '\n' && r != -1 {
+		r = sc.get()
 	}
 	sc.unget()
 
-	sc.typ = DurationLit
-	sc.lit = string(lit)
+	c := &Comment{
+		baseNode: baseNode{
+			pos: pos,
+		},
+		Text: strings.TrimRight(sc.stopLit(), " \t\r"),
+	}
+
+	if line != pos.Line && len(sc.comments) > 0 {
+		g := sc.comments[len(sc.comments)-1]
+
+		if !g.line && g.End().Line == pos.Line-1 {
+			g.List = append(g.List, c)
+			return
+		}
+	}
+
+	sc.comments = append(sc.comments, &CommentGroup{
+		List: []*Comment{c},
+		line: line == pos.Line,
+	})
 }
 
 func (sc *scanner) next() {
 	nlsemi := sc.nlsemi
 	sc.nlsemi = false
 
+	// Record the line on which the previous token ended so we know if any
+	// comment follows it on the same line.
+	line := sc.line
+
+	if sc.tok == _Semi && sc.lit == "newline" {
+		line = 0
+	}
+
 redo:
 	sc.tok = token(0)
 	sc.lit = sc.lit[0:0]
+	sc.raw = ""
 	sc.typ = LitType(0)
 
 	r := sc.get()
@@ -150,9 +603,7 @@ redo:
 	}
 
 	if r == '#' {
-		for r != '\n' {
-			r = sc.get()
-		}
+		sc.comment(line)
 		goto redo
 	}
 
@@ -164,41 +615,26 @@ redo:
 	}
 
 	if isDigit(r) || r == '-' {
-		sc.number()
-
-		r = sc.get()
-
-		lit := []rune(sc.lit)
-
-		// Check if we have a suffix for a duration or size literal.
-		switch r {
-		case 's', 'm', 'h':
-			sc.duration(r)
-		case 'B':
-			lit = append(lit, r)
-			sc.typ = SizeLit
-			sc.lit = string(lit)
-		case 'K', 'M', 'G', 'T':
-			lit = append(lit, r)
-
-			if r = sc.get(); r == 'B' {
-				lit = append(lit, r)
-				sc.typ = SizeLit
-				sc.lit = string(lit)
-				break
-			}
-			sc.unget()
-		default:
-			sc.unget()
-		}
+		sc.number(r)
 		return
 	}
 
 	switch r {
 	case -1:
 		sc.tok = _EOF
-	case '\n', ';':
+	case '\n':
+		// Position the newline at the end of the line it terminates.
+		sc.pos = Pos{
+			File:   sc.name,
+			Line:   sc.line0,
+			Col:    sc.col0 + 1,
+			Offset: sc.pos0,
+		}
+		sc.tok = _Semi
+		sc.lit = "newline"
+	case ';':
 		sc.tok = _Semi
+		sc.lit = "semicolon"
 	case ',':
 		sc.tok = _Comma
 	case '{':
@@ -213,6 +649,10 @@ redo:
 		sc.tok = _Rbrack
 	case '"':
 		sc.string()
+	case '`':
+		sc.rawString()
+	case '<':
+		sc.heredoc()
 	default:
 		sc.err(fmt.Sprintf("unexpected token %U", r))
 		goto redo
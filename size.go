@@ -0,0 +1,186 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+)
+
+// Size is a number of bytes. The String method of a Size returns a size
+// literal, so sizes can be encoded in a human readable way.
+type Size int64
+
+// Common sizes. The SI sizes are powers of 1000, and the IEC sizes are powers
+// of 1024.
+const (
+	Byte Size = 1
+
+	Kilobyte = 1000 * Byte
+	Megabyte = 1000 * Kilobyte
+	Gigabyte = 1000 * Megabyte
+	Terabyte = 1000 * Gigabyte
+	Petabyte = 1000 * Terabyte
+
+	Kibibyte = 1024 * Byte
+	Mebibyte = 1024 * Kibibyte
+	Gibibyte = 1024 * Mebibyte
+	Tebibyte = 1024 * Gibibyte
+	Pebibyte = 1024 * Tebibyte
+)
+
+var sizeType = reflect.TypeOf(Size(0))
+
+// sizeUnits is the order in which units are tried when formatting a size.
+var sizeUnits = []struct {
+	name string
+	size Size
+}{
+	{"PB", Petabyte},
+	{"PiB", Pebibyte},
+	{"TB", Terabyte},
+	{"TiB", Tebibyte},
+	{"GB", Gigabyte},
+	{"GiB", Gibibyte},
+	{"MB", Megabyte},
+	{"MiB", Mebibyte},
+	{"kB", Kilobyte},
+	{"KiB", Kibibyte},
+}
+
+// ParseSize parses a size literal, such as 50MB or 1.5GiB. The SI units are
+// always powers of 1000.
+func ParseSize(s string) (Size, error) {
+	n, err := parseSize(s, false)
+
+	if err != nil {
+		return 0, errors.New("config: " + err.Error())
+	}
+	return Size(n), nil
+}
+
+// String returns the size as a size literal. This uses whichever unit, SI or
+// IEC, gives the shortest exact representation of the size, for example 50MB,
+// or 50MiB.
+func (s Size) String() string {
+	if s == 0 {
+		return "0B"
+	}
+
+	var sign string
+
+	n := uint64(s)
+
+	if s < 0 {
+		sign = "-"
+		n = -n
+	}
+
+	str := strconv.FormatUint(n, 10) + "B"
+
+	for _, u := range sizeUnits {
+		if n%uint64(u.size) != 0 {
+			continue
+		}
+
+		if unit := strconv.FormatUint(n/uint64(u.size), 10) + u.name; len(unit) < len(str) {
+			str = unit
+		}
+	}
+	return sign + str
+}
+
+// Bytes returns the size as an integer number of bytes.
+func (s Size) Bytes() int64 { return int64(s) }
+
+// Kilobytes returns the size as a floating point number of kilobytes.
+func (s Size) Kilobytes() float64 { return float64(s) / float64(Kilobyte) }
+
+// Megabytes returns the size as a floating point number of megabytes.
+func (s Size) Megabytes() float64 { return float64(s) / float64(Megabyte) }
+
+// Gigabytes returns the size as a floating point number of gigabytes.
+func (s Size) Gigabytes() float64 { return float64(s) / float64(Gigabyte) }
+
+// Kibibytes returns the size as a floating point number of kibibytes.
+func (s Size) Kibibytes() float64 { return float64(s) / float64(Kibibyte) }
+
+// Mebibytes returns the size as a floating point number of mebibytes.
+func (s Size) Mebibytes() float64 { return float64(s) / float64(Mebibyte) }
+
+// Gibibytes returns the size as a floating point number of gibibytes.
+func (s Size) Gibibytes() float64 { return float64(s) / float64(Gibibyte) }
+
+// Truncate returns the result of rounding s towards zero to a multiple of m.
+// If m <= 0, then s is returned unchanged.
+func (s Size) Truncate(m Size) Size {
+	if m <= 0 {
+		return s
+	}
+	return s - s%m
+}
+
+// Round returns the result of rounding s to the nearest multiple of m,
+// rounding halfway values away from zero. If m <= 0, then s is returned
+// unchanged.
+func (s Size) Round(m Size) Size {
+	if m <= 0 {
+		return s
+	}
+
+	r := s % m
+
+	if s < 0 {
+		if -r+-r < m {
+			return s - r
+		}
+		return s - r - m
+	}
+
+	if r+r < m {
+		return s - r
+	}
+	return s - r + m
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s Size) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (s *Size) UnmarshalText(b []byte) error {
+	n, err := ParseSize(string(b))
+
+	if err != nil {
+		return err
+	}
+
+	*s = n
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler. The size is marshalled as a string
+// containing the size literal.
+func (s Size) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler. This accepts either a string
+// containing a size literal, or a number of bytes.
+func (s *Size) UnmarshalJSON(b []byte) error {
+	var str string
+
+	if err := json.Unmarshal(b, &str); err == nil {
+		return s.UnmarshalText([]byte(str))
+	}
+
+	var n int64
+
+	if err := json.Unmarshal(b, &n); err != nil {
+		return errors.New("config: cannot unmarshal " + string(b) + " into Size")
+	}
+
+	*s = Size(n)
+	return nil
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func Test_SizeString(t *testing.T) {
+	tests := []struct {
+		size     Size
+		expected string
+	}{
+		{0, "0B"},
+		{1, "1B"},
+		{1023, "1023B"},
+		{Kilobyte, "1kB"},
+		{Kibibyte, "1KiB"},
+		{50 * Megabyte, "50MB"},
+		{50 * Mebibyte, "50MiB"},
+		{1500 * Megabyte, "1500MB"},
+		{2048 * Kilobyte, "2048kB"},
+		{3 * Pebibyte, "3PiB"},
+		{-5 * Gigabyte, "-5GB"},
+	}
+
+	for _, test := range tests {
+		if s := test.size.String(); s != test.expected {
+			t.Errorf("Size(%d) - unexpected String, expected=%q, got=%q\n", int64(test.size), test.expected, s)
+		}
+
+		size, err := ParseSize(test.expected)
+
+		if err != nil {
+			t.Errorf("Size(%d) - %s\n", int64(test.size), err)
+			continue
+		}
+
+		if size != test.size {
+			t.Errorf("%q - unexpected ParseSize, expected=%d, got=%d\n", test.expected, int64(test.size), int64(size))
+		}
+	}
+
+	for _, s := range []string{"", "MB", "10", "1.5B", "1/2MB", "1e3MB", "10XB"} {
+		if _, err := ParseSize(s); err == nil {
+			t.Errorf("%q - expected error, got nil\n", s)
+		}
+	}
+}
+
+func Test_SizeRound(t *testing.T) {
+	tests := []struct {
+		size     Size
+		m        Size
+		round    Size
+		truncate Size
+	}{
+		{1500 * Kilobyte, Megabyte, 2 * Megabyte, Megabyte},
+		{1499 * Kilobyte, Megabyte, Megabyte, Megabyte},
+		{-1500 * Kilobyte, Megabyte, -2 * Megabyte, -Megabyte},
+		{1500, 0, 1500, 1500},
+	}
+
+	for _, test := range tests {
+		if r := test.size.Round(test.m); r != test.round {
+			t.Errorf("%s.Round(%s) - expected=%s, got=%s\n", test.size, test.m, test.round, r)
+		}
+
+		if r := test.size.Truncate(test.m); r != test.truncate {
+			t.Errorf("%s.Truncate(%s) - expected=%s, got=%s\n", test.size, test.m, test.truncate, r)
+		}
+	}
+}
+
+func Test_SizeJSON(t *testing.T) {
+	var v struct {
+		Limit Size
+	}
+
+	v.Limit = 50 * Megabyte
+
+	b, err := json.Marshal(v)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := `{"Limit":"50MB"}`; string(b) != expected {
+		t.Fatalf("unexpected json, expected=%q, got=%q\n", expected, string(b))
+	}
+
+	for _, src := range []string{`{"Limit":"50MiB"}`, `{"Limit":52428800}`} {
+		v.Limit = 0
+
+		if err := json.Unmarshal([]byte(src), &v); err != nil {
+			t.Fatal(err)
+		}
+
+		if v.Limit != 50*Mebibyte {
+			t.Fatalf("%s - unexpected Limit, expected=%s, got=%s\n", src, 50*Mebibyte, v.Limit)
+		}
+	}
+}
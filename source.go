@@ -1,16 +1,18 @@
 package config
 
 import (
-	"errors"
 	"io"
 	"strconv"
 	"unicode/utf8"
 )
 
+// Pos is a position in a source. Offset is the byte offset of the position
+// from the start of the source.
 type Pos struct {
-	File string
-	Line int
-	Col  int
+	File   string
+	Line   int
+	Col    int
+	Offset int
 }
 
 func (p Pos) String() string {
@@ -26,31 +28,31 @@ func (p Pos) String() string {
 	return s
 }
 
+// Err returns an *Error with the given message at the position.
 func (p Pos) Err(msg string) error {
-	return errors.New(p.String() + " - " + msg)
+	return &Error{Pos: p, Msg: msg}
 }
 
-// source represents a source file being parsed for tokens. This records the
-// current and previous position in the buffer using pos and pos0 respectively
-// as well ass line0, line and col0, col for for explicit positional information
-// for error reporting.
-//
-// eof denotes where in the buffer the EOF occurs.
+// source represents a source file being parsed for tokens. The entire source
+// is read into buf when the first rune is requested. This records the current
+// and previous position in the buffer using pos and pos0 respectively as well
+// as line0, line and col0, col for for explicit positional information for
+// error reporting.
 //
 // lit denotes the start position of a literal that we want to copy from the
 // underlying buffer. If lit is < 0 when a copy of a literal is made then the
 // a panic will happen.
 //
-// The errh callback is called to handle the reporting of errors that may occur
-// during parsing of a file.
+// Each error that occurs during parsing of a file is recorded in errs. The errh
+// callback, if not nil, is also called for each error as it occurs.
 type source struct {
 	name        string
 	r           io.Reader
 	pos0, pos   int
-	eof         int
 	line0, line int
 	col0, col   int
 	errh        func(Pos, string)
+	errs        ErrorList
 	buf         []byte
 	lit         int
 }
@@ -64,52 +66,54 @@ func newSource(name string, r io.Reader, errh func(Pos, string)) *source {
 		line: 1,
 		errh: errh,
 		lit:  -1,
-		buf:  make([]byte, 4096),
 	}
 }
 
-// getpos returns the current position in the source.
+// getpos returns the position of the rune that was last returned by get.
 func (s *source) getpos() Pos {
 	return Pos{
-		File: s.name,
-		Line: s.line,
-		Col:  s.col,
+		File:   s.name,
+		Line:   s.line,
+		Col:    s.col,
+		Offset: s.pos0,
+	}
+}
+
+// errAt records an error at the given position.
+func (s *source) errAt(pos Pos, msg string) {
+	s.errs.Add(pos, msg)
+
+	if s.errh != nil {
+		s.errh(pos, msg)
 	}
 }
 
 func (s *source) err(msg string) {
-	s.errh(s.getpos(), msg)
+	s.errAt(s.getpos(), msg)
 }
 
 // get returns the next rune in the source. If EOF has been reached then -1
 // is returned. If a fatal error occurs when reading from the underlying
-// source, then an error is recorded via errh and -1 is returned.
+// source, then an error is recorded and -1 is returned.
 func (s *source) get() rune {
 redo:
 	s.pos0, s.line0, s.col0 = s.pos, s.line, s.col
 
-	if s.pos == 0 || s.pos >= len(s.buf) {
-		if s.lit >= 0 {
-			buf := s.buf[s.lit:s.pos]
+	if s.buf == nil {
+		b, err := io.ReadAll(s.r)
 
-			s.buf = make([]byte, len(s.buf)+len(buf))
-			copy(s.buf, buf)
+		if err != nil {
+			s.err("io error: " + err.Error())
 		}
 
-		n, err := s.r.Read(s.buf)
+		s.buf = b
 
-		if err != nil {
-			if !errors.Is(err, io.EOF) {
-				s.err("io error: " + err.Error())
-			}
-			return -1
+		if s.buf == nil {
+			s.buf = []byte{}
 		}
-
-		s.pos = 0
-		s.eof = n
 	}
 
-	if s.pos == s.eof {
+	if s.pos >= len(s.buf) {
 		return -1
 	}
 
@@ -0,0 +1,79 @@
+package config
+
+import "fmt"
+
+// Visitor has its Visit method invoked for each node encountered by Walk. If
+// the returned Visitor w is not nil, then Walk visits each of the children of
+// the node with w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(n Node) (w Visitor)
+}
+
+// Walk traverses the parse tree in depth-first order. It starts by calling
+// v.Visit(n), and if the returned Visitor is not nil then Walk is invoked
+// recursively for each of the children of the node, followed by a call of
+// w.Visit(nil).
+func Walk(v Visitor, n Node) {
+	if v = v.Visit(n); v == nil {
+		return
+	}
+
+	switch n := n.(type) {
+	case *File:
+		for _, p := range n.Params {
+			Walk(v, p)
+		}
+	case *Param:
+		if n.Doc != nil {
+			Walk(v, n.Doc)
+		}
+
+		Walk(v, n.Name)
+
+		if n.Label != nil {
+			Walk(v, n.Label)
+		}
+
+		if n.Value != nil {
+			Walk(v, n.Value)
+		}
+
+		if n.Comment != nil {
+			Walk(v, n.Comment)
+		}
+	case *CommentGroup:
+		for _, c := range n.List {
+			Walk(v, c)
+		}
+	case *Block:
+		for _, p := range n.Params {
+			Walk(v, p)
+		}
+	case *Array:
+		for _, it := range n.Items {
+			Walk(v, it)
+		}
+	case *Comment, *Name, *Lit:
+		// Nothing to do.
+	default:
+		panic(fmt.Sprintf("config.Walk: unexpected node type %T", n))
+	}
+
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(n Node) Visitor {
+	if f(n) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses the parse tree in depth-first order. It starts by calling
+// f(n), and if f returns true then Inspect is invoked recursively for each of
+// the children of the node, followed by a call of f(nil).
+func Inspect(n Node, f func(Node) bool) {
+	Walk(inspector(f), n)
+}